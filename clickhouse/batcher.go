@@ -0,0 +1,480 @@
+package infraclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBatchMaxRows       = 10000
+	defaultBatchMaxBytes      = 16 << 20
+	defaultBatchFlushInterval = time.Second
+	defaultBatchFlushTimeout  = 30 * time.Second
+	defaultBatchMaxRetries    = 3
+	defaultBatchRetryBackoff  = time.Second
+)
+
+const (
+	flushReasonRows     = "rows"
+	flushReasonBytes    = "bytes"
+	flushReasonInterval = "interval"
+	flushReasonStop     = "stop"
+)
+
+var (
+	// ErrBufferFull is returned by Add if the buffer is full and the batcher drops rows
+	ErrBufferFull = errors.New("batcher buffer is full")
+
+	// ErrBatcherStopped is returned by Add after the batcher is stopped
+	ErrBatcherStopped = errors.New("batcher is stopped")
+)
+
+var batcherMetrics struct {
+	Rows          *prometheus.CounterVec
+	Flushes       *prometheus.CounterVec
+	FlushDuration *prometheus.HistogramVec
+	BufferedRows  *prometheus.GaugeVec
+}
+var batcherMetricsOnce sync.Once
+
+func initBatcherMetrics() {
+	batcherMetricsOnce.Do(func() {
+		batcherMetrics.Rows = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clickhouse_batcher_rows_counter",
+			Help: "The total number of rows passed to a batcher by status: inserted, dropped or failed",
+		}, []string{"connection", "table", "status"})
+
+		batcherMetrics.Flushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clickhouse_batcher_flushes_counter",
+			Help: "The total number of batch inserts by flush reason and status",
+		}, []string{"connection", "table", "reason", "status"})
+
+		batcherMetrics.FlushDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "clickhouse_batcher_flush_duration",
+			Help:    "The batch insert duration including retries",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"connection", "table"})
+
+		batcherMetrics.BufferedRows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "clickhouse_batcher_buffered_rows",
+			Help: "The number of rows waiting for a flush",
+		}, []string{"connection", "table"})
+
+		prometheus.MustRegister(
+			batcherMetrics.Rows,
+			batcherMetrics.Flushes,
+			batcherMetrics.FlushDuration,
+			batcherMetrics.BufferedRows,
+		)
+	})
+}
+
+type BatcherConfig struct {
+	// Columns of inserted rows. All table columns in table order if not set
+	Columns []string `mapstructure:"columns"`
+
+	// Batch is flushed when it has that many rows. Default is 10000
+	MaxRows int `mapstructure:"max_rows"`
+
+	// Batch is flushed when its estimated size reaches that many bytes. Default is 16MiB
+	MaxBytes int `mapstructure:"max_bytes"`
+
+	// Batch is flushed at least that often if it's not empty. Default is 1s
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// Maximum number of rows waiting for a flush in addition to the current batch. Default is MaxRows
+	BufferSize int `mapstructure:"buffer_size"`
+
+	// Whether to drop rows when the buffer is full. Add blocks until there is room otherwise
+	DropOnFull bool `mapstructure:"drop_on_full"`
+
+	// Number of retries of a failed flush. Rows are dropped when retries run out. Default is 3, -1 disables retries
+	MaxRetries int `mapstructure:"max_retries"`
+
+	// Delay before the first retry. It's doubled on each next retry. Default is 1s
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+
+	// Timeout of a single batch insert. Default is 30s
+	FlushTimeout time.Duration `mapstructure:"flush_timeout"`
+}
+
+func (c *BatcherConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.MaxRows < 0 || c.MaxBytes < 0 || c.BufferSize < 0 {
+		return errors.New("max_rows, max_bytes and buffer_size must not be negative")
+	}
+
+	if c.MaxRetries < -1 {
+		return errors.New("max_retries must be -1 or greater")
+	}
+
+	if c.FlushInterval < 0 || c.RetryBackoff < 0 || c.FlushTimeout < 0 {
+		return errors.New("durations must not be negative")
+	}
+
+	return nil
+}
+
+func (c *BatcherConfig) withDefaults() *BatcherConfig {
+	cfg := BatcherConfig{}
+	if c != nil {
+		cfg = *c
+	}
+
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = defaultBatchMaxRows
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultBatchMaxBytes
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultBatchFlushInterval
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = cfg.MaxRows
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultBatchMaxRetries
+	} else if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultBatchRetryBackoff
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = defaultBatchFlushTimeout
+	}
+
+	return &cfg
+}
+
+// Batcher buffers rows of a table in memory and inserts them in batches.
+// A batch is flushed when it reaches MaxRows or MaxBytes, or FlushInterval passes.
+// Rows buffered when the process dies are lost, so it's intended for data that tolerates losses.
+type Batcher struct {
+	db    *sql.DB
+	name  string
+	table string
+	query string
+	cfg   *BatcherConfig
+
+	rows chan []interface{}
+
+	// ctx is canceled when Stop gives up waiting, so inserts and retries in progress are aborted
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards sending to rows against the final drain on Stop
+	mu       sync.RWMutex
+	stopping chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+	started  atomic.Bool
+	stopOnce sync.Once
+}
+
+var (
+	_ infraoperator.Starter = (*Batcher)(nil)
+	_ infraoperator.Stopper = (*Batcher)(nil)
+)
+
+// CreateBatcher creates a batcher of a table by a connection name. cfg may be nil
+func (cont *Container) CreateBatcher(connectionName string, table string, cfg *BatcherConfig) (*Batcher, error) {
+	db := cont.Get(connectionName)
+	if db == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	if table == "" {
+		return nil, errors.New("table is mandatory")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.withDefaults()
+
+	initBatcherMetrics()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Batcher{
+		db:       db,
+		name:     connectionName,
+		table:    table,
+		query:    insertQuery(table, cfg.Columns),
+		cfg:      cfg,
+		rows:     make(chan []interface{}, cfg.BufferSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stopping: make(chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func insertQuery(table string, columns []string) string {
+	query := "INSERT INTO " + table
+	if len(columns) > 0 {
+		query += " (" + strings.Join(columns, ", ") + ")"
+	}
+
+	return query
+}
+
+// Add adds a row to the buffer. Values must match Columns.
+// If the buffer is full, Add either returns ErrBufferFull or blocks until there is room or ctx is done.
+func (b *Batcher) Add(ctx context.Context, values ...interface{}) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	select {
+	case <-b.stopping:
+		return ErrBatcherStopped
+	default:
+	}
+
+	select {
+	case b.rows <- values:
+		return nil
+	default:
+	}
+
+	if b.cfg.DropOnFull {
+		batcherMetrics.Rows.WithLabelValues(b.name, b.table, "dropped").Inc()
+		return ErrBufferFull
+	}
+
+	select {
+	case b.rows <- values:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.stopping:
+		return ErrBatcherStopped
+	}
+}
+
+// Start starts flushing batches in background
+func (b *Batcher) Start(_ context.Context) error {
+	if b.started.CompareAndSwap(false, true) {
+		go b.run()
+	}
+
+	return nil
+}
+
+// Stop stops accepting rows and flushes all buffered ones.
+// If ctx is done earlier, inserts and retries in progress are aborted and the rest of rows are dropped.
+// Rows of a batcher that was never started are dropped.
+func (b *Batcher) Stop(ctx context.Context) error {
+	b.stopOnce.Do(func() {
+		close(b.stopping)
+
+		// wait for Add calls in progress, so no rows are sent after the final drain
+		b.mu.Lock()
+		close(b.quit)
+		b.mu.Unlock()
+	})
+
+	// done is closed by run only
+	if !b.started.Load() {
+		b.cancel()
+		return nil
+	}
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+	defer b.cancel()
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := &batch{}
+	for {
+		select {
+		case values := <-b.rows:
+			batch.add(values)
+			if batch.len() >= b.cfg.MaxRows {
+				b.flush(batch, flushReasonRows)
+			} else if batch.bytes >= b.cfg.MaxBytes {
+				b.flush(batch, flushReasonBytes)
+			}
+
+		case <-ticker.C:
+			b.flush(batch, flushReasonInterval)
+
+		case <-b.quit:
+			b.drain(batch)
+			return
+		}
+
+		batcherMetrics.BufferedRows.WithLabelValues(b.name, b.table).Set(float64(batch.len() + len(b.rows)))
+	}
+}
+
+// drain flushes all buffered rows
+func (b *Batcher) drain(batch *batch) {
+	for {
+		select {
+		case values := <-b.rows:
+			batch.add(values)
+			if batch.len() >= b.cfg.MaxRows || batch.bytes >= b.cfg.MaxBytes {
+				b.flush(batch, flushReasonStop)
+			}
+		default:
+			b.flush(batch, flushReasonStop)
+			batcherMetrics.BufferedRows.WithLabelValues(b.name, b.table).Set(0)
+			return
+		}
+	}
+}
+
+// flush inserts a batch with retries and resets it. Rows are dropped if all attempts fail
+func (b *Batcher) flush(batch *batch, reason string) {
+	if batch.len() == 0 {
+		return
+	}
+	defer batch.reset()
+
+	start := time.Now()
+	err := b.insertWithRetries(batch.rows)
+	batcherMetrics.FlushDuration.WithLabelValues(b.name, b.table).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		infralog.Error("can't insert clickhouse batch",
+			zap.String("connection", b.name),
+			zap.String("table", b.table),
+			zap.Int("rows", batch.len()),
+			zap.Error(err),
+		)
+		batcherMetrics.Flushes.WithLabelValues(b.name, b.table, reason, "error").Inc()
+		batcherMetrics.Rows.WithLabelValues(b.name, b.table, "failed").Add(float64(batch.len()))
+		return
+	}
+
+	batcherMetrics.Flushes.WithLabelValues(b.name, b.table, reason, "success").Inc()
+	batcherMetrics.Rows.WithLabelValues(b.name, b.table, "inserted").Add(float64(batch.len()))
+}
+
+func (b *Batcher) insertWithRetries(rows [][]interface{}) error {
+	backoff := b.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := b.insert(rows)
+		if err == nil || attempt >= b.cfg.MaxRetries {
+			return err
+		}
+
+		infralog.Warn("clickhouse batch insert failed, retrying",
+			zap.String("connection", b.name),
+			zap.String("table", b.table),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// insert sends rows in a single batch by a prepared insert statement
+func (b *Batcher) insert(rows [][]interface{}) error {
+	ctx, cancel := context.WithTimeout(b.ctx, b.cfg.FlushTimeout)
+	defer cancel()
+
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, b.query)
+	if err != nil {
+		return errors.Wrap(err, "prepare")
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for i, row := range rows {
+		if _, err = stmt.ExecContext(ctx, row...); err != nil {
+			return errors.Wrapf(err, "row %d", i)
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "send")
+}
+
+// batch is rows collected for a single insert
+type batch struct {
+	rows  [][]interface{}
+	bytes int
+}
+
+func (b *batch) add(values []interface{}) {
+	b.rows = append(b.rows, values)
+	b.bytes += rowSize(values)
+}
+
+func (b *batch) len() int {
+	return len(b.rows)
+}
+
+func (b *batch) reset() {
+	b.rows = nil
+	b.bytes = 0
+}
+
+// rowSize estimates size of a row in the native format
+func rowSize(values []interface{}) int {
+	size := 0
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			size += len(v) + 1
+		case []byte:
+			size += len(v) + 1
+		case []string:
+			for _, s := range v {
+				size += len(s) + 1
+			}
+			size += 8
+		case bool, int8, uint8:
+			size++
+		case int16, uint16:
+			size += 2
+		case int32, uint32, float32:
+			size += 4
+		default:
+			size += 8
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,252 @@
+package infraclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pushwoosh/infra/internal/fakesql"
+)
+
+// fakeInserter collects rows of committed batches.
+// Commits fail while failures are left.
+type fakeInserter struct {
+	*fakesql.DB
+	batches chan [][]driver.Value
+}
+
+func newFakeInserter(failures int) *fakeInserter {
+	f := &fakeInserter{batches: make(chan [][]driver.Value, 100)}
+
+	var pending [][]driver.Value
+	f.DB = &fakesql.DB{
+		Exec: func(_ string, args []driver.Value) (driver.Result, error) {
+			pending = append(pending, args)
+			return driver.RowsAffected(1), nil
+		},
+		Commit: func() error {
+			rows := pending
+			pending = nil
+
+			if failures > 0 {
+				failures--
+				return errors.New("insert failed")
+			}
+
+			f.batches <- rows
+			return nil
+		},
+		Rollback: func() error {
+			pending = nil
+			return nil
+		},
+	}
+
+	return f
+}
+
+// wait returns the next committed batch
+func (f *fakeInserter) wait(t *testing.T) [][]driver.Value {
+	t.Helper()
+
+	select {
+	case rows := <-f.batches:
+		return rows
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch is not inserted")
+		return nil
+	}
+}
+
+func startBatcher(t *testing.T, inserter *fakeInserter, cfg *BatcherConfig) *Batcher {
+	t.Helper()
+
+	db := sql.OpenDB(inserter.DB)
+	t.Cleanup(func() { _ = db.Close() })
+
+	cont := NewContainer()
+	cont.conns["test"] = db
+
+	b, err := cont.CreateBatcher("test", "events", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func addRows(t *testing.T, b *Batcher, rows ...string) {
+	t.Helper()
+
+	for _, row := range rows {
+		if err := b.Add(context.Background(), row); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_rowSize(t *testing.T) {
+	size := rowSize([]interface{}{"abc", []byte{1, 2}, int32(1), uint8(1), int64(1), []string{"a", "bc"}})
+	if want := 4 + 3 + 4 + 1 + 8 + 2 + 3 + 8; size != want {
+		t.Errorf("rowSize = %d, want %d", size, want)
+	}
+}
+
+func Test_Batcher_Add(t *testing.T) {
+	db, err := sql.Open("clickhouse", "clickhouse://user@localhost:9000/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	cont := NewContainer()
+	cont.conns["test"] = db
+
+	b, err := cont.CreateBatcher("test", "events", &BatcherConfig{
+		Columns:    []string{"id", "name"},
+		BufferSize: 1,
+		DropOnFull: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.query != "INSERT INTO events (id, name)" {
+		t.Errorf("unexpected query: %s", b.query)
+	}
+
+	if err = b.Add(context.Background(), 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Add(context.Background(), 2, "b"); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Add to full buffer returned %v, want ErrBufferFull", err)
+	}
+
+	// batcher isn't started, so Stop can't finish and returns on ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = b.Stop(ctx)
+
+	if err = b.Add(context.Background(), 3, "c"); !errors.Is(err, ErrBatcherStopped) {
+		t.Errorf("Add after Stop returned %v, want ErrBatcherStopped", err)
+	}
+}
+
+func Test_Batcher_Flush(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *BatcherConfig
+		rows []string
+		stop bool
+		want int
+	}{
+		{
+			name: "by rows",
+			cfg:  &BatcherConfig{MaxRows: 3, FlushInterval: time.Hour},
+			rows: []string{"a", "b", "c", "d"},
+			want: 3,
+		},
+		{
+			name: "by bytes",
+			cfg:  &BatcherConfig{MaxBytes: 10, FlushInterval: time.Hour},
+			rows: []string{"abcd", "efgh", "ijkl"},
+			want: 2,
+		},
+		{
+			name: "by interval",
+			cfg:  &BatcherConfig{FlushInterval: 20 * time.Millisecond},
+			rows: []string{"a", "b"},
+			want: 2,
+		},
+		{
+			name: "on stop",
+			cfg:  &BatcherConfig{FlushInterval: time.Hour},
+			rows: []string{"a", "b"},
+			stop: true,
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inserter := newFakeInserter(0)
+			b := startBatcher(t, inserter, tt.cfg)
+			addRows(t, b, tt.rows...)
+
+			if tt.stop {
+				if err := b.Stop(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				defer func() { _ = b.Stop(context.Background()) }()
+			}
+
+			if rows := inserter.wait(t); len(rows) != tt.want {
+				t.Errorf("inserted %d rows, want %d", len(rows), tt.want)
+			}
+		})
+	}
+}
+
+func Test_Batcher_Retry(t *testing.T) {
+	inserter := newFakeInserter(2)
+	b := startBatcher(t, inserter, &BatcherConfig{
+		FlushInterval: time.Hour,
+		RetryBackoff:  time.Millisecond,
+	})
+	addRows(t, b, "a", "b")
+
+	if err := b.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := inserter.wait(t); len(rows) != 2 {
+		t.Errorf("inserted %d rows, want 2", len(rows))
+	}
+}
+
+func Test_Batcher_StopAbortsRetries(t *testing.T) {
+	inserter := newFakeInserter(100)
+	b := startBatcher(t, inserter, &BatcherConfig{
+		FlushInterval: time.Hour,
+		RetryBackoff:  time.Hour,
+	})
+	addRows(t, b, "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := b.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop returned %v, want deadline exceeded", err)
+	}
+
+	select {
+	case <-b.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry backoff is not aborted")
+	}
+}
+
+func Test_Batcher_StopNotStarted(t *testing.T) {
+	cont := NewContainer()
+	cont.conns["test"] = sql.OpenDB(newFakeInserter(0).DB)
+
+	b, err := cont.CreateBatcher("test", "events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = b.Stop(ctx); err != nil {
+		t.Errorf("Stop returned %v", err)
+	}
+}
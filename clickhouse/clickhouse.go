@@ -1,11 +1,13 @@
 package infraclickhouse
 
 import (
+	"context"
 	"database/sql"
 	"sync"
 	"time"
 
-	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/dlmiddlecote/sqlstats"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,6 +19,7 @@ type Container struct {
 	cfg        map[string]ConnectionConfig
 	conns      map[string]*sql.DB
 	collectors map[string]*sqlstats.StatsCollector
+	natives    map[string]driver.Conn
 }
 
 func NewContainer() *Container {
@@ -25,42 +28,68 @@ func NewContainer() *Container {
 		cfg:        make(map[string]ConnectionConfig),
 		conns:      make(map[string]*sql.DB),
 		collectors: make(map[string]*sqlstats.StatsCollector),
+		natives:    make(map[string]driver.Conn),
 	}
 }
 
-// Connect creates a new named clickhouse connection
+// Connect creates a new named clickhouse connection.
+// If Native is set, a native connection is also available via GetNative.
+// Queries of both connections are instrumented according to QueryLog.
 func (cont *Container) Connect(name string, cfg *ConnectionConfig) error {
-	dsn := cfg.GetConnectionDSN()
-	conn, err := sql.Open("clickhouse", dsn)
-	if err != nil {
-		return errors.Wrapf(err, "sql.Open")
-	}
-
-	err = conn.Ping()
-	if err != nil {
-		return errors.Wrapf(err, "conn.Ping")
-	}
-
 	if cfg.MaxConnections <= 0 {
 		cfg.MaxConnections = 10
 	}
-	conn.SetMaxOpenConns(cfg.MaxConnections)
-
 	if cfg.MaxIdleConnections <= 0 {
 		cfg.MaxIdleConnections = 4
 	}
-	conn.SetMaxIdleConns(cfg.MaxIdleConnections)
-
 	if cfg.MaxConnectionLifetime <= 0 {
 		cfg.MaxConnectionLifetime = 1 * time.Hour
 	}
-	conn.SetConnMaxLifetime(cfg.MaxConnectionLifetime)
-
 	if cfg.MaxConnectionIdleTime <= 0 {
 		cfg.MaxConnectionIdleTime = 10 * time.Second
 	}
+
+	opts, err := cfg.Options()
+	if err != nil {
+		return errors.Wrap(err, "options")
+	}
+
+	tracer := newQueryTracer(name, cfg.QueryLog)
+
+	conn := sql.OpenDB(newTracedConnector(clickhouse.Connector(opts), tracer))
+	conn.SetMaxOpenConns(cfg.MaxConnections)
+	conn.SetMaxIdleConns(cfg.MaxIdleConnections)
+	conn.SetConnMaxLifetime(cfg.MaxConnectionLifetime)
 	conn.SetConnMaxIdleTime(cfg.MaxConnectionIdleTime)
 
+	err = conn.Ping()
+	if err != nil {
+		_ = conn.Close()
+		return errors.Wrapf(err, "conn.Ping")
+	}
+
+	var native driver.Conn
+	if cfg.Native {
+		nativeOpts := *opts
+		nativeOpts.MaxOpenConns = cfg.MaxConnections
+		nativeOpts.MaxIdleConns = cfg.MaxIdleConnections
+		nativeOpts.ConnMaxLifetime = cfg.MaxConnectionLifetime
+
+		native, err = clickhouse.Open(&nativeOpts)
+		if err != nil {
+			_ = conn.Close()
+			return errors.Wrap(err, "clickhouse.Open")
+		}
+
+		if err = native.Ping(context.Background()); err != nil {
+			_ = native.Close()
+			_ = conn.Close()
+			return errors.Wrap(err, "native.Ping")
+		}
+
+		native = newTracedConn(native, tracer)
+	}
+
 	if collector := cont.GetCollector(name); collector != nil {
 		prometheus.Unregister(collector)
 	}
@@ -74,6 +103,12 @@ func (cont *Container) Connect(name string, cfg *ConnectionConfig) error {
 	cont.cfg[name] = *cfg
 	cont.collectors[name] = collector
 
+	if native != nil {
+		cont.natives[name] = native
+	} else {
+		delete(cont.natives, name)
+	}
+
 	return nil
 }
 
@@ -85,6 +120,14 @@ func (cont *Container) Get(name string) *sql.DB {
 	return cont.conns[name]
 }
 
+// GetNative gets native connection from a container
+func (cont *Container) GetNative(name string) driver.Conn {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	return cont.natives[name]
+}
+
 // GetCollector gets metrics collector from a container
 func (cont *Container) GetCollector(name string) *sqlstats.StatsCollector {
 	cont.mu.RLock()
@@ -1,18 +1,40 @@
 package infraclickhouse
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/pkg/errors"
 )
 
+var compressionMethods = map[string]clickhouse.CompressionMethod{
+	"none":  clickhouse.CompressionNone,
+	"lz4":   clickhouse.CompressionLZ4,
+	"lz4hc": clickhouse.CompressionLZ4HC,
+	"zstd":  clickhouse.CompressionZSTD,
+}
+
+var connOpenStrategies = map[string]clickhouse.ConnOpenStrategy{
+	"in_order":    clickhouse.ConnOpenInOrder,
+	"round_robin": clickhouse.ConnOpenRoundRobin,
+	"random":      clickhouse.ConnOpenRandom,
+}
+
 type ConnectionsConfig map[string]*ConnectionConfig
 
 type ConnectionConfig struct {
-	// Database address. "host:port"
+	// Database address. "host:port".
+	// Comma-separated list of "host:port" is allowed, hosts are chosen according to ConnOpenStrategy
 	Address string `mapstructure:"address"`
 
+	// Order of choosing a host for a new connection: "in_order" (default), "round_robin" or "random"
+	ConnOpenStrategy string `mapstructure:"conn_open_strategy"`
+
 	// Database credentials
 	Credentials Credentials `mapstructure:"credentials"`
 
@@ -27,6 +49,57 @@ type ConnectionConfig struct {
 
 	// Connection idle time. Connections that idle more than that period will be closed
 	MaxConnectionIdleTime time.Duration `mapstructure:"max_connection_idle_time"`
+
+	// Query settings applied to every query, e.g. max_execution_time. Optional
+	Settings map[string]interface{} `mapstructure:"settings"`
+
+	// Compression method of data blocks: "none" (default), "lz4", "lz4hc" or "zstd"
+	Compression string `mapstructure:"compression"`
+
+	// Compression level. Applied to "lz4hc" only
+	CompressionLevel int `mapstructure:"compression_level"`
+
+	// Timeout of establishing a connection. Client default (30s) is used if not set
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+
+	// Timeout of reading a server response. Client default (5m) is used if not set
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+
+	// TLS config. Optional
+	TLS *TLSConfig `mapstructure:"tls"`
+
+	// Whether to also create a native clickhouse-go connection, available via GetNative
+	Native bool `mapstructure:"native"`
+
+	// Query logging. Optional
+	QueryLog *QueryLoggingConfig `mapstructure:"query_log"`
+}
+
+// QueryLoggingConfig enables query logging. Queries are logged at debug level, as the mongo query log does
+type QueryLoggingConfig struct {
+	// Whether to log all queries
+	All bool `mapstructure:"all"`
+
+	// Whether to log slow queries
+	Slow bool `mapstructure:"slow"`
+
+	// Queries that were executed longer than that time will appear in slow log
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+}
+
+type TLSConfig struct {
+	// Path to CA certificate file. System CAs are used if not set
+	CAFile string `mapstructure:"ca_file"`
+
+	// Paths to client certificate and key files. Optional
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+
+	// Server name used for certificate verification. Optional
+	ServerName string `mapstructure:"server_name"`
+
+	// Disables server certificate verification. Use for testing only
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
 }
 
 type Credentials struct {
@@ -46,6 +119,82 @@ func (c *ConnectionConfig) GetConnectionDSN() string {
 	)
 }
 
+// Options returns clickhouse-go options built from the config.
+// Connection pool limits are not set, since Connect applies them by database/sql setters.
+// Set them on Options passed to clickhouse.Open.
+func (c *ConnectionConfig) Options() (*clickhouse.Options, error) {
+	opts := &clickhouse.Options{
+		Addr: splitAddress(c.Address),
+		Auth: clickhouse.Auth{
+			Database: c.Credentials.Database,
+			Username: c.Credentials.Username,
+			Password: c.Credentials.Password,
+		},
+		Settings:         clickhouse.Settings(c.Settings),
+		DialTimeout:      c.DialTimeout,
+		ReadTimeout:      c.ReadTimeout,
+		ConnOpenStrategy: connOpenStrategies[c.ConnOpenStrategy],
+	}
+
+	if c.Compression != "" {
+		opts.Compression = &clickhouse.Compression{
+			Method: compressionMethods[c.Compression],
+			Level:  c.CompressionLevel,
+		}
+	}
+
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.config()
+		if err != nil {
+			return nil, errors.Wrap(err, "tls")
+		}
+		opts.TLS = tlsConfig
+	}
+
+	return opts, nil
+}
+
+func splitAddress(address string) []string {
+	var hosts []string
+	for _, host := range strings.Split(address, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+func (c *TLSConfig) config() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "ca_file")
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("ca_file: no certificates found")
+		}
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cert_file")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 func (c *ConnectionsConfig) Validate() error {
 	if c == nil {
 		return nil
@@ -73,6 +222,50 @@ func (c *ConnectionConfig) Validate() error {
 		return errors.Wrap(err, "credentials")
 	}
 
+	if _, ok := connOpenStrategies[c.ConnOpenStrategy]; !ok && c.ConnOpenStrategy != "" {
+		return errors.Errorf("unknown conn_open_strategy \"%s\"", c.ConnOpenStrategy)
+	}
+
+	if _, ok := compressionMethods[c.Compression]; !ok && c.Compression != "" {
+		return errors.Errorf("unknown compression \"%s\"", c.Compression)
+	}
+
+	if c.DialTimeout < 0 || c.ReadTimeout < 0 {
+		return errors.New("dial_timeout and read_timeout must not be negative")
+	}
+
+	if err := c.TLS.Validate(); err != nil {
+		return errors.Wrap(err, "tls")
+	}
+
+	if err := c.QueryLog.Validate(); err != nil {
+		return errors.Wrap(err, "query_log")
+	}
+
+	return nil
+}
+
+func (c *QueryLoggingConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.Slow && c.SlowThreshold == 0 {
+		return errors.New("slow threshold must be greater than zero")
+	}
+
+	return nil
+}
+
+func (c *TLSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("both cert_file and key_file must be set")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,67 @@
+package infraclickhouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func Test_Options(t *testing.T) {
+	cfg := &ConnectionConfig{
+		Address:          "ch1:9000, ch2:9000",
+		ConnOpenStrategy: "round_robin",
+		Credentials: Credentials{
+			Database: "app",
+			Username: "user",
+			Password: "pass",
+		},
+		Settings:         map[string]interface{}{"max_execution_time": 60},
+		Compression:      "lz4hc",
+		CompressionLevel: 3,
+		DialTimeout:      time.Second,
+		TLS:              &TLSConfig{ServerName: "ch.local"},
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := cfg.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts.Addr) != 2 || opts.Addr[0] != "ch1:9000" || opts.Addr[1] != "ch2:9000" {
+		t.Errorf("invalid addresses: %v", opts.Addr)
+	}
+
+	if opts.ConnOpenStrategy != clickhouse.ConnOpenRoundRobin {
+		t.Errorf("invalid conn open strategy: %v", opts.ConnOpenStrategy)
+	}
+
+	if opts.Auth.Database != "app" || opts.Auth.Username != "user" || opts.Auth.Password != "pass" {
+		t.Errorf("invalid auth: %+v", opts.Auth)
+	}
+
+	if opts.Settings["max_execution_time"] != 60 {
+		t.Errorf("invalid settings: %v", opts.Settings)
+	}
+
+	if opts.Compression == nil || opts.Compression.Method != clickhouse.CompressionLZ4HC || opts.Compression.Level != 3 {
+		t.Errorf("invalid compression: %+v", opts.Compression)
+	}
+
+	if opts.TLS == nil || opts.TLS.ServerName != "ch.local" {
+		t.Errorf("invalid tls: %+v", opts.TLS)
+	}
+
+	if opts.DialTimeout != time.Second {
+		t.Errorf("invalid dial timeout: %s", opts.DialTimeout)
+	}
+
+	cfg.Compression = "snappy"
+	if err = cfg.Validate(); err == nil {
+		t.Error("unknown compression is accepted")
+	}
+}
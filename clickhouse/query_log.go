@@ -0,0 +1,206 @@
+package infraclickhouse
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"go.uber.org/zap"
+)
+
+var metrics struct {
+	QueryDurationHistogram *prometheus.HistogramVec
+	ReadRowsCounter        *prometheus.CounterVec
+	ReadBytesCounter       *prometheus.CounterVec
+}
+var metricsOnce sync.Once
+
+func initMetrics() {
+	metricsOnce.Do(func() {
+		metrics.QueryDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "clickhouse_query_duration",
+			Help:    "The clickhouse query duration",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, math.Inf(1)},
+		}, []string{"connection", "query", "command", "status"})
+
+		metrics.ReadRowsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clickhouse_query_read_rows_counter",
+			Help: "The total number of rows read by clickhouse queries",
+		}, []string{"connection", "query"})
+
+		metrics.ReadBytesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clickhouse_query_read_bytes_counter",
+			Help: "The total number of bytes read by clickhouse queries",
+		}, []string{"connection", "query"})
+
+		prometheus.MustRegister(
+			metrics.QueryDurationHistogram,
+			metrics.ReadRowsCounter,
+			metrics.ReadBytesCounter,
+		)
+	})
+}
+
+type queryNameCtxKey struct{}
+type queryIDCtxKey struct{}
+type progressCtxKey struct{}
+type profileInfoCtxKey struct{}
+
+// WithQueryName puts a query name into the context. It is used as a metrics label and a log field
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameCtxKey{}, name)
+}
+
+// QueryNameFromContext returns a query name put into the context by WithQueryName
+func QueryNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(queryNameCtxKey{}).(string)
+	return name
+}
+
+// WithQueryID puts a query id into the context. The id is sent to the server, so the query may be found in system.query_log
+func WithQueryID(ctx context.Context, id string) context.Context {
+	ctx = clickhouse.Context(ctx, clickhouse.WithQueryID(id))
+	return context.WithValue(ctx, queryIDCtxKey{}, id)
+}
+
+// QueryIDFromContext returns a query id put into the context by WithQueryID
+func QueryIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(queryIDCtxKey{}).(string)
+	return id
+}
+
+// WithProgress puts a progress callback into the context.
+// Instrumented connections replace callbacks set by clickhouse.WithProgress, so this one should be used instead.
+func WithProgress(ctx context.Context, fn func(*clickhouse.Progress)) context.Context {
+	ctx = clickhouse.Context(ctx, clickhouse.WithProgress(fn))
+	return context.WithValue(ctx, progressCtxKey{}, fn)
+}
+
+// WithProfileInfo puts a profile info callback into the context.
+// Instrumented connections replace callbacks set by clickhouse.WithProfileInfo, so this one should be used instead.
+func WithProfileInfo(ctx context.Context, fn func(*clickhouse.ProfileInfo)) context.Context {
+	ctx = clickhouse.Context(ctx, clickhouse.WithProfileInfo(fn))
+	return context.WithValue(ctx, profileInfoCtxKey{}, fn)
+}
+
+// queryStats collects stats of a query from progress and profile info packets.
+// Packets are received by the connection reader, so counters are atomic.
+type queryStats struct {
+	readRows   atomic.Uint64
+	readBytes  atomic.Uint64
+	resultRows atomic.Uint64
+}
+
+func (s *queryStats) progress(p *clickhouse.Progress) {
+	s.readRows.Add(p.Rows)
+	s.readBytes.Add(p.Bytes)
+}
+
+func (s *queryStats) profileInfo(p *clickhouse.ProfileInfo) {
+	s.resultRows.Add(p.Rows)
+}
+
+// callbacks returns progress and profile info callbacks collecting stats.
+// Callbacks of the context set by WithProgress and WithProfileInfo are called too.
+func (s *queryStats) callbacks(ctx context.Context) (func(*clickhouse.Progress), func(*clickhouse.ProfileInfo)) {
+	progress := s.progress
+	if fn, ok := ctx.Value(progressCtxKey{}).(func(*clickhouse.Progress)); ok {
+		progress = func(p *clickhouse.Progress) {
+			s.progress(p)
+			fn(p)
+		}
+	}
+
+	profileInfo := s.profileInfo
+	if fn, ok := ctx.Value(profileInfoCtxKey{}).(func(*clickhouse.ProfileInfo)); ok {
+		profileInfo = func(p *clickhouse.ProfileInfo) {
+			s.profileInfo(p)
+			fn(p)
+		}
+	}
+
+	return progress, profileInfo
+}
+
+// queryTracer instruments queries of a connection
+type queryTracer struct {
+	name string
+	cfg  *QueryLoggingConfig
+}
+
+func newQueryTracer(name string, cfg *QueryLoggingConfig) *queryTracer {
+	initMetrics()
+
+	return &queryTracer{
+		name: name,
+		cfg:  cfg,
+	}
+}
+
+// start subscribes to query stats and returns a context to run the query with
+// and a function to call when the query is finished
+func (t *queryTracer) start(ctx context.Context, command string, query string) (context.Context, func(err error)) {
+	stats := &queryStats{}
+	progress, profileInfo := stats.callbacks(ctx)
+	ctx = clickhouse.Context(ctx, clickhouse.WithProgress(progress), clickhouse.WithProfileInfo(profileInfo))
+
+	start := time.Now()
+	var once sync.Once
+
+	return ctx, func(err error) {
+		once.Do(func() {
+			t.finish(ctx, command, query, time.Since(start), stats, err)
+		})
+	}
+}
+
+func (t *queryTracer) finish(ctx context.Context, command string, query string, duration time.Duration, stats *queryStats, err error) {
+	queryName := QueryNameFromContext(ctx)
+	readRows, readBytes := stats.readRows.Load(), stats.readBytes.Load()
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	metrics.QueryDurationHistogram.WithLabelValues(t.name, queryName, command, status).Observe(duration.Seconds())
+	metrics.ReadRowsCounter.WithLabelValues(t.name, queryName).Add(float64(readRows))
+	metrics.ReadBytesCounter.WithLabelValues(t.name, queryName).Add(float64(readBytes))
+
+	if t.cfg == nil {
+		return
+	}
+
+	slow := t.cfg.Slow && duration > t.cfg.SlowThreshold
+	if !t.cfg.All && !slow {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("connection", t.name),
+		zap.String("command", command),
+		zap.String("query", query),
+		zap.Duration("duration", duration),
+		zap.Uint64("read_rows", readRows),
+		zap.Uint64("read_bytes", readBytes),
+		zap.Uint64("result_rows", stats.resultRows.Load()),
+	}
+	if queryName != "" {
+		fields = append(fields, zap.String("query_name", queryName))
+	}
+	if queryID := QueryIDFromContext(ctx); queryID != "" {
+		fields = append(fields, zap.String("query_id", queryID))
+	}
+
+	if err != nil {
+		infralog.DebugCtx(ctx, "query failed", append(fields, zap.Error(err))...)
+		return
+	}
+
+	infralog.DebugCtx(ctx, "query succeeded", fields...)
+}
@@ -0,0 +1,64 @@
+package infraclickhouse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_queryTracer(t *testing.T) {
+	tracer := newQueryTracer("test", &QueryLoggingConfig{All: true})
+
+	ctx := WithQueryName(WithQueryID(context.Background(), "id-1"), "events")
+	if QueryIDFromContext(ctx) != "id-1" || QueryNameFromContext(ctx) != "events" {
+		t.Fatalf("unexpected query id and name: %s %s", QueryIDFromContext(ctx), QueryNameFromContext(ctx))
+	}
+
+	queryCtx, finish := tracer.start(ctx, "Select", "SELECT count() FROM events")
+	if QueryIDFromContext(queryCtx) != "id-1" {
+		t.Error("query id is lost")
+	}
+
+	// progress packets carry increments, profile info carries result rows
+	stats := &queryStats{}
+	stats.progress(&clickhouse.Progress{Rows: 10, Bytes: 100})
+	stats.progress(&clickhouse.Progress{Rows: 5, Bytes: 50})
+	stats.profileInfo(&clickhouse.ProfileInfo{Rows: 1})
+	if stats.readRows.Load() != 15 || stats.readBytes.Load() != 150 || stats.resultRows.Load() != 1 {
+		t.Errorf("unexpected stats: %d %d %d", stats.readRows.Load(), stats.readBytes.Load(), stats.resultRows.Load())
+	}
+
+	finish(nil)
+	finish(nil)
+
+	// a finished query is observed once
+	m := &dto.Metric{}
+	if err := metrics.QueryDurationHistogram.WithLabelValues("test", "events", "Select", "success").(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if count := m.GetHistogram().GetSampleCount(); count != 1 {
+		t.Errorf("observed %d queries, want 1", count)
+	}
+}
+
+func Test_queryStats_callbacks(t *testing.T) {
+	var progressRows, profileRows uint64
+	ctx := WithProgress(context.Background(), func(p *clickhouse.Progress) { progressRows += p.Rows })
+	ctx = WithProfileInfo(ctx, func(p *clickhouse.ProfileInfo) { profileRows += p.Rows })
+
+	stats := &queryStats{}
+	progress, profileInfo := stats.callbacks(ctx)
+	progress(&clickhouse.Progress{Rows: 10, Bytes: 100})
+	profileInfo(&clickhouse.ProfileInfo{Rows: 2})
+
+	if stats.readRows.Load() != 10 || stats.resultRows.Load() != 2 {
+		t.Errorf("stats are not collected: %d %d", stats.readRows.Load(), stats.resultRows.Load())
+	}
+
+	if progressRows != 10 || profileRows != 2 {
+		t.Errorf("context callbacks are not called: %d %d", progressRows, profileRows)
+	}
+}
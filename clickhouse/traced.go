@@ -0,0 +1,239 @@
+package infraclickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+
+	chdriver "github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/pkg/errors"
+)
+
+// tracedConn instruments queries of a native connection.
+// Batches are measured from PrepareBatch to Send.
+type tracedConn struct {
+	chdriver.Conn
+	tracer *queryTracer
+}
+
+func newTracedConn(conn chdriver.Conn, tracer *queryTracer) chdriver.Conn {
+	return &tracedConn{Conn: conn, tracer: tracer}
+}
+
+func (c *tracedConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, finish := c.tracer.start(ctx, "Select", query)
+	err := c.Conn.Select(ctx, dest, query, args...)
+	finish(err)
+
+	return err
+}
+
+func (c *tracedConn) Query(ctx context.Context, query string, args ...any) (chdriver.Rows, error) {
+	ctx, finish := c.tracer.start(ctx, "Query", query)
+	rows, err := c.Conn.Query(ctx, query, args...)
+	if err != nil {
+		finish(err)
+		return nil, err
+	}
+
+	return &tracedRows{Rows: rows, finish: finish}, nil
+}
+
+func (c *tracedConn) QueryRow(ctx context.Context, query string, args ...any) chdriver.Row {
+	ctx, finish := c.tracer.start(ctx, "QueryRow", query)
+	row := c.Conn.QueryRow(ctx, query, args...)
+	if err := row.Err(); err != nil {
+		finish(err)
+		return row
+	}
+
+	return &tracedRow{Row: row, finish: finish}
+}
+
+func (c *tracedConn) Exec(ctx context.Context, query string, args ...any) error {
+	ctx, finish := c.tracer.start(ctx, "Exec", query)
+	err := c.Conn.Exec(ctx, query, args...)
+	finish(err)
+
+	return err
+}
+
+func (c *tracedConn) AsyncInsert(ctx context.Context, query string, wait bool, args ...any) error {
+	ctx, finish := c.tracer.start(ctx, "AsyncInsert", query)
+	err := c.Conn.AsyncInsert(ctx, query, wait, args...)
+	finish(err)
+
+	return err
+}
+
+func (c *tracedConn) PrepareBatch(ctx context.Context, query string, opts ...chdriver.PrepareBatchOption) (chdriver.Batch, error) {
+	ctx, finish := c.tracer.start(ctx, "Batch", query)
+	batch, err := c.Conn.PrepareBatch(ctx, query, opts...)
+	if err != nil {
+		finish(err)
+		return nil, err
+	}
+
+	return &tracedBatch{Batch: batch, finish: finish}, nil
+}
+
+// tracedRows finishes a query when rows are closed
+type tracedRows struct {
+	chdriver.Rows
+	finish func(err error)
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if rowsErr := r.Rows.Err(); rowsErr != nil {
+		r.finish(rowsErr)
+	} else {
+		r.finish(err)
+	}
+
+	return err
+}
+
+// tracedRow finishes a query when a row is scanned, so reading of the row is measured
+type tracedRow struct {
+	chdriver.Row
+	finish func(err error)
+}
+
+func (r *tracedRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	r.finish(err)
+
+	return err
+}
+
+func (r *tracedRow) ScanStruct(dest any) error {
+	err := r.Row.ScanStruct(dest)
+	r.finish(err)
+
+	return err
+}
+
+// tracedBatch finishes a query when a batch is sent or aborted
+type tracedBatch struct {
+	chdriver.Batch
+	finish func(err error)
+}
+
+func (b *tracedBatch) Send() error {
+	err := b.Batch.Send()
+	b.finish(err)
+
+	return err
+}
+
+func (b *tracedBatch) Abort() error {
+	err := b.Batch.Abort()
+	b.finish(err)
+
+	return err
+}
+
+// stdConn is a set of interfaces implemented by clickhouse database/sql connections
+type stdConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.NamedValueChecker
+}
+
+// stdRows is a set of interfaces implemented by clickhouse database/sql rows
+type stdRows interface {
+	driver.Rows
+	driver.RowsColumnTypeScanType
+	driver.RowsColumnTypeDatabaseTypeName
+	driver.RowsColumnTypeNullable
+	driver.RowsColumnTypePrecisionScale
+	driver.RowsNextResultSet
+}
+
+// tracedConnector instruments queries of database/sql connections.
+// Prepared statements, which are used for batch inserts, are not instrumented.
+type tracedConnector struct {
+	driver.Connector
+	tracer *queryTracer
+}
+
+func newTracedConnector(connector driver.Connector, tracer *queryTracer) driver.Connector {
+	return &tracedConnector{Connector: connector, tracer: tracer}
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	std, ok := conn.(stdConn)
+	if !ok {
+		return conn, nil
+	}
+
+	return &tracedStdConn{stdConn: std, tracer: c.tracer}, nil
+}
+
+type tracedStdConn struct {
+	stdConn
+	tracer *queryTracer
+}
+
+func (c *tracedStdConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, finish := c.tracer.start(ctx, "Exec", query)
+	res, err := c.stdConn.ExecContext(ctx, query, args)
+	finish(err)
+
+	return res, err
+}
+
+func (c *tracedStdConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, finish := c.tracer.start(ctx, "Query", query)
+	rows, err := c.stdConn.QueryContext(ctx, query, args)
+	if err != nil {
+		finish(err)
+		return nil, err
+	}
+
+	std, ok := rows.(stdRows)
+	if !ok {
+		finish(nil)
+		return rows, nil
+	}
+
+	return &tracedStdRows{stdRows: std, finish: finish}, nil
+}
+
+// tracedStdRows finishes a query when rows are closed
+type tracedStdRows struct {
+	stdRows
+	finish func(err error)
+	err    error
+}
+
+func (r *tracedStdRows) Next(dest []driver.Value) error {
+	err := r.stdRows.Next(dest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+
+	return err
+}
+
+func (r *tracedStdRows) Close() error {
+	err := r.stdRows.Close()
+	if r.err != nil {
+		r.finish(r.err)
+	} else {
+		r.finish(err)
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package infraclickhouse
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+)
+
+// fakeStdRows returns errors of Next in order
+type fakeStdRows struct {
+	stdRows
+	errs []error
+}
+
+func (r *fakeStdRows) Next([]driver.Value) error {
+	err := r.errs[0]
+	r.errs = r.errs[1:]
+
+	return err
+}
+
+func (r *fakeStdRows) Close() error {
+	return nil
+}
+
+// fakeRow returns an error of Scan
+type fakeRow struct {
+	err error
+}
+
+func (r *fakeRow) Err() error           { return nil }
+func (r *fakeRow) Scan(...any) error    { return r.err }
+func (r *fakeRow) ScanStruct(any) error { return r.err }
+
+func Test_tracedStdRows(t *testing.T) {
+	broken := errors.New("broken")
+
+	tests := []struct {
+		name string
+		errs []error
+		want error
+	}{
+		{name: "success", errs: []error{nil, nil, io.EOF}, want: nil},
+		{name: "error", errs: []error{nil, broken}, want: broken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				finished bool
+				got      error
+			)
+			rows := &tracedStdRows{
+				stdRows: &fakeStdRows{errs: tt.errs},
+				finish: func(err error) {
+					finished = true
+					got = err
+				},
+			}
+
+			for rows.Next(nil) == nil {
+				// read all rows
+			}
+
+			if finished {
+				t.Fatal("query is finished before rows are closed")
+			}
+
+			if err := rows.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !finished || !errors.Is(got, tt.want) {
+				t.Errorf("finished: %v with %v, want %v", finished, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tracedRow(t *testing.T) {
+	broken := errors.New("broken")
+
+	var got error
+	finishes := 0
+	row := &tracedRow{
+		Row: &fakeRow{err: broken},
+		finish: func(err error) {
+			finishes++
+			got = err
+		},
+	}
+
+	if err := row.Scan(); !errors.Is(err, broken) {
+		t.Errorf("Scan returned %v", err)
+	}
+
+	if finishes != 1 || !errors.Is(got, broken) {
+		t.Errorf("query finished %d times with %v", finishes, got)
+	}
+}
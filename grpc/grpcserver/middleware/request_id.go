@@ -0,0 +1,34 @@
+package inframiddleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pushwoosh/infra/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerRequestIDInterceptor returns a grpc server unary interceptor
+// that puts request id from "x-request-id" metadata into request's context.
+// A new request id is generated if the metadata is missing.
+// The request id is propagated further through message headers, see infrapropagation.
+func UnaryServerRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(infrapropagation.WithRequestID(ctx, requestIDFromMetadata(ctx)), req)
+	}
+}
+
+func requestIDFromMetadata(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(infrapropagation.HeaderRequestID); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
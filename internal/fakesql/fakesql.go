@@ -0,0 +1,166 @@
+// Package fakesql provides a database/sql connector for tests.
+// Executed statements are recorded and answered by callbacks.
+package fakesql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// DB is a driver.Connector whose connections share the callbacks and the statement log.
+// Callbacks are called one at a time, unset callbacks succeed.
+type DB struct {
+	// Exec answers ExecContext and executions of prepared statements
+	Exec func(query string, args []driver.Value) (driver.Result, error)
+	// Query answers QueryContext
+	Query    func(query string, args []driver.Value) (driver.Rows, error)
+	Begin    func(opts driver.TxOptions) error
+	Commit   func() error
+	Rollback func() error
+
+	mu         sync.Mutex
+	statements []Statement
+}
+
+// Statement is an executed query with its arguments
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// Statements returns executed statements in order.
+// It must not be called from the callbacks.
+func (db *DB) Statements() []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]Statement(nil), db.statements...)
+}
+
+func (db *DB) Connect(context.Context) (driver.Conn, error) { return &conn{db: db}, nil }
+func (db *DB) Driver() driver.Driver                        { return nil }
+
+func (db *DB) exec(query string, args []driver.Value) (driver.Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.statements = append(db.statements, Statement{Query: query, Args: args})
+	if db.Exec == nil {
+		return driver.RowsAffected(0), nil
+	}
+
+	return db.Exec(query, args)
+}
+
+func (db *DB) query(query string, args []driver.Value) (driver.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.statements = append(db.statements, Statement{Query: query, Args: args})
+	if db.Query == nil {
+		return NewRows(nil), nil
+	}
+
+	return db.Query(query, args)
+}
+
+func (db *DB) call(fn func() error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if fn == nil {
+		return nil
+	}
+
+	return fn()
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{db: c.db, query: query}, nil }
+func (c *conn) Close() error                              { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	err := c.db.call(func() error {
+		if c.db.Begin == nil {
+			return nil
+		}
+		return c.db.Begin(opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx{db: c.db}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.db.exec(query, values(args))
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(query, values(args))
+}
+
+type tx struct {
+	db *DB
+}
+
+func (t *tx) Commit() error   { return t.db.call(t.db.Commit) }
+func (t *tx) Rollback() error { return t.db.call(t.db.Rollback) }
+
+type stmt struct {
+	db    *DB
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.db.exec(s.query, args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.db.query(s.query, args)
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	ret := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		ret = append(ret, arg.Value)
+	}
+
+	return ret
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// NewRows returns rows with given columns and values
+func NewRows(columns []string, values ...[]driver.Value) driver.Rows {
+	return &rows{columns: columns, values: values}
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package infrakafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+const handlerRetryDelay = time.Second
+
+// OffsetStore keeps consumer offsets outside Kafka,
+// e.g. in the same database transaction as processing results.
+type OffsetStore interface {
+	// LoadOffsets returns offsets of the next messages to read by partition.
+	// Partitions without stored offsets are omitted.
+	LoadOffsets(ctx context.Context, group string, topic string) (map[int]int64, error)
+}
+
+// AssignedConsumer reads explicitly assigned partitions starting from offsets loaded from an OffsetStore.
+// Offsets are never committed to the group coordinator, the handler is responsible for storing them.
+// A message failed by the handler is processed again until it succeeds.
+type AssignedConsumer struct {
+	cfg        *ConnectionConfig
+	group      string
+	topic      string
+	partitions []int
+	store      OffsetStore
+	handler    Handler
+
+	readers []*kafka.Reader
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// CreateAssignedConsumer creates a new consumer of given partitions of a topic by a connection name.
+// All partitions of the topic are assigned if partitions is empty.
+// group is only used as a key for the offset store.
+func (cont *Container) CreateAssignedConsumer(
+	connectionName string,
+	group string,
+	topic string,
+	partitions []int,
+	store OffsetStore,
+	handler Handler,
+) (*AssignedConsumer, error) {
+	kafkaConfig, err := cont.getConfig(connectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if store == nil {
+		return nil, errors.New("offset store is mandatory")
+	}
+
+	return &AssignedConsumer{
+		cfg:        kafkaConfig,
+		group:      group,
+		topic:      topic,
+		partitions: partitions,
+		store:      store,
+		handler:    handler,
+	}, nil
+}
+
+// Start assigns partitions, seeks them to stored offsets and starts consuming in background
+func (c *AssignedConsumer) Start(ctx context.Context) error {
+	partitions := c.partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = c.topicPartitions(ctx); err != nil {
+			return err
+		}
+	}
+
+	offsets, err := c.store.LoadOffsets(ctx, c.group, c.topic)
+	if err != nil {
+		return errors.Wrap(err, "load offsets")
+	}
+
+	defaultOffset := kafka.FirstOffset
+	if c.cfg.StartOffset == StartOffsetLast {
+		defaultOffset = kafka.LastOffset
+	}
+
+	readers := make([]*kafka.Reader, 0, len(partitions))
+	for _, partition := range partitions {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     c.cfg.Brokers(),
+			Topic:       c.topic,
+			Partition:   partition,
+			Logger:      kafka.LoggerFunc(getLogFunc()),
+			ErrorLogger: kafka.LoggerFunc(getLogErrorFunc()),
+			MaxAttempts: 1000,
+		})
+
+		offset, ok := offsets[partition]
+		if !ok {
+			offset = defaultOffset
+		}
+
+		if err = reader.SetOffset(offset); err != nil {
+			_ = reader.Close()
+			_ = closeReaders(readers)
+			return errors.Wrapf(err, "seek partition %d", partition)
+		}
+
+		readers = append(readers, reader)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	c.readers = readers
+	c.cancel = cancel
+
+	for _, reader := range readers {
+		c.wg.Add(1)
+		go func(reader *kafka.Reader) {
+			defer c.wg.Done()
+			c.consume(runCtx, reader)
+		}(reader)
+	}
+
+	return nil
+}
+
+// Stop stops consuming and waits until all consumer goroutines exit
+func (c *AssignedConsumer) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return closeReaders(c.readers)
+}
+
+func (c *AssignedConsumer) topicPartitions(ctx context.Context) ([]int, error) {
+	existing, err := listTopics(ctx, newAdminClient(c.cfg), []string{c.topic})
+	if err != nil {
+		return nil, err
+	}
+
+	topic, ok := existing[c.topic]
+	if !ok {
+		return nil, errors.Errorf("topic \"%s\" doesn't exist", c.topic)
+	}
+
+	partitions := make([]int, 0, len(topic.Partitions))
+	for _, partition := range topic.Partitions {
+		partitions = append(partitions, partition.ID)
+	}
+
+	return partitions, nil
+}
+
+func (c *AssignedConsumer) consume(ctx context.Context, reader *kafka.Reader) {
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			infralog.Error("can't read kafka message",
+				zap.String("topic", c.topic),
+				zap.Int("partition", reader.Config().Partition),
+				zap.Error(err))
+			continue
+		}
+
+		// the offset is stored by the handler, so the message is retried until it succeeds
+		for {
+			err = c.handler(ctx, msg)
+			if err == nil {
+				break
+			}
+
+			infralog.Error("can't process kafka message",
+				zap.String("topic", msg.Topic),
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+				zap.Error(err))
+
+			select {
+			case <-time.After(handlerRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func closeReaders(readers []*kafka.Reader) error {
+	var err error
+	for _, reader := range readers {
+		if closeErr := reader.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,69 @@
+package infrakafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeOffsetStore returns fixed offsets of the next messages to read
+type fakeOffsetStore map[int]int64
+
+func (s fakeOffsetStore) LoadOffsets(context.Context, string, string) (map[int]int64, error) {
+	return s, nil
+}
+
+func Test_AssignedConsumer_Start(t *testing.T) {
+	tests := []struct {
+		name        string
+		startOffset StartOffset
+		want        map[int]int64
+	}{
+		{
+			name:        "first offset of partitions without stored ones",
+			startOffset: StartOffsetFirst,
+			want:        map[int]int64{0: 42, 1: kafka.FirstOffset},
+		},
+		{
+			name:        "last offset of partitions without stored ones",
+			startOffset: StartOffsetLast,
+			want:        map[int]int64{0: 42, 1: kafka.LastOffset},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cont := NewContainer()
+			_ = cont.AddConnection("test", &ConnectionConfig{Address: "localhost:1", StartOffset: tt.startOffset})
+
+			// the offset after the last processed message 41 is stored
+			store := fakeOffsetStore{0: 42}
+
+			consumer, err := cont.CreateAssignedConsumer("test", "group", "events", []int{0, 1}, store,
+				func(ctx context.Context, msg kafka.Message) error { return nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = consumer.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, reader := range consumer.readers {
+				partition := reader.Config().Partition
+				if offset := reader.Offset(); offset != tt.want[partition] {
+					t.Errorf("partition %d starts at %d, want %d", partition, offset, tt.want[partition])
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err = consumer.Stop(ctx); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
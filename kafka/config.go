@@ -1,6 +1,10 @@
 package infrakafka
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +21,55 @@ type ConnectionConfig struct {
 	// Broker Address. Comma-separated list of "host:port" expected
 	Address     string      `mapstructure:"address"`
 	StartOffset StartOffset `mapstructure:"start_offset"`
+
+	// Disables topic auto creation by producers.
+	// Topics are expected to be created by EnsureTopics in that case.
+	DisableAutoTopicCreation bool `mapstructure:"disable_auto_topic_creation"`
+
+	// Topics ensured by EnsureTopics. Key is a topic name
+	Topics map[string]*TopicConfig `mapstructure:"topics"`
+}
+
+// TopicConfig is a declarative topic specification
+type TopicConfig struct {
+	// Number of partitions. Broker default is used if not set
+	Partitions int `mapstructure:"partitions"`
+
+	// Replication factor. Broker default is used if not set
+	ReplicationFactor int `mapstructure:"replication_factor"`
+
+	// Retention time, "retention.ms" topic config. Broker default is used if not set
+	Retention time.Duration `mapstructure:"retention"`
+
+	// Cleanup policy, "cleanup.policy" topic config: "delete", "compact" or "compact,delete"
+	CleanupPolicy string `mapstructure:"cleanup_policy"`
+
+	// Other topic configs, e.g. "min.insync.replicas"
+	Configs map[string]string `mapstructure:"configs"`
+}
+
+// RetryConfig describes retry and dead-letter topics of a source topic.
+type RetryConfig struct {
+	// Delays before each retry attempt.
+	// The message is moved to "<topic>.retry.<n>" with Delays[n-1] delay on the n-th failure,
+	// and to "<topic>.dlq" after all retries are exhausted.
+	Delays []time.Duration `mapstructure:"delays"`
+
+	// Number of partitions of retry and dead-letter topics. Broker default is used if not set.
+	Partitions int `mapstructure:"partitions"`
+
+	// Replication factor of retry and dead-letter topics. Broker default is used if not set.
+	ReplicationFactor int `mapstructure:"replication_factor"`
+}
+
+// Brokers returns a list of broker addresses
+func (c *ConnectionConfig) Brokers() []string {
+	brokers := strings.Split(c.Address, ",")
+	for i := range brokers {
+		brokers[i] = strings.TrimSpace(brokers[i])
+	}
+
+	return brokers
 }
 
 func (c *ConnectionsConfig) Validate() error {
@@ -50,5 +103,77 @@ func (c *ConnectionConfig) Validate() error {
 		return errors.New("start_offset must be either 'first' or 'last'")
 	}
 
+	for name, topic := range c.Topics {
+		if err := topic.Validate(); err != nil {
+			return errors.Wrapf(err, "topics.%s", name)
+		}
+	}
+
+	return nil
+}
+
+func (c *TopicConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty topic config")
+	}
+
+	if c.Partitions < 0 {
+		return errors.New("partitions must not be negative")
+	}
+
+	if c.ReplicationFactor < 0 {
+		return errors.New("replication_factor must not be negative")
+	}
+
+	if c.Retention < 0 {
+		return errors.New("retention must not be negative")
+	}
+
+	switch c.CleanupPolicy {
+	case "", "delete", "compact", "compact,delete", "delete,compact":
+	default:
+		return errors.Errorf("invalid cleanup_policy \"%s\"", c.CleanupPolicy)
+	}
+
+	return nil
+}
+
+// configEntries returns topic-level configs that are set explicitly
+func (c *TopicConfig) configEntries() map[string]string {
+	ret := make(map[string]string, len(c.Configs)+2)
+	for name, value := range c.Configs {
+		ret[name] = value
+	}
+
+	if c.Retention > 0 {
+		ret["retention.ms"] = strconv.FormatInt(c.Retention.Milliseconds(), 10)
+	}
+
+	if c.CleanupPolicy != "" {
+		ret["cleanup.policy"] = c.CleanupPolicy
+	}
+
+	return ret
+}
+
+func (c *RetryConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty retry config")
+	}
+
+	for i, delay := range c.Delays {
+		if delay < 0 {
+			return errors.Errorf("delay #%d must not be negative", i+1)
+		}
+	}
+
+	if c.Partitions < 0 {
+		return errors.New("partitions must not be negative")
+	}
+
+	if c.ReplicationFactor < 0 {
+		return errors.New("replication_factor must not be negative")
+	}
+
 	return nil
 }
@@ -52,6 +52,19 @@ func getLogErrorFunc() func(msg string, a ...interface{}) {
 	}
 }
 
+// getConfig gets connection config by a connection name
+func (cont *Container) getConfig(connectionName string) (*ConnectionConfig, error) {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	kafkaConfig, ok := cont.cfg[connectionName]
+	if !ok {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	return kafkaConfig, nil
+}
+
 // CreateProducer creates a new kafka producer by a connection name
 func (cont *Container) CreateProducer(connectionName string) (*kafka.Writer, error) {
 	cont.mu.Lock()
@@ -63,8 +76,8 @@ func (cont *Container) CreateProducer(connectionName string) (*kafka.Writer, err
 	}
 
 	return &kafka.Writer{
-		Addr:                   kafka.TCP(kafkaConfig.Address),
-		AllowAutoTopicCreation: true,
+		Addr:                   kafka.TCP(kafkaConfig.Brokers()...),
+		AllowAutoTopicCreation: !kafkaConfig.DisableAutoTopicCreation,
 		Async:                  true,
 		MaxAttempts:            1000,
 		Logger:                 kafka.LoggerFunc(getLogFunc()),
@@ -94,7 +107,7 @@ func (cont *Container) CreateConsumer(
 	}
 
 	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{kafkaConfig.Address},
+		Brokers:        kafkaConfig.Brokers(),
 		GroupID:        consumerGroup,
 		GroupTopics:    topics,
 		QueueCapacity:  0,
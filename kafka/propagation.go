@@ -0,0 +1,56 @@
+package infrakafka
+
+import (
+	"context"
+
+	"github.com/pushwoosh/infra/propagation"
+	"github.com/segmentio/kafka-go"
+)
+
+// headersCarrier adapts kafka message headers to the propagation carrier
+type headersCarrier struct {
+	msg *kafka.Message
+}
+
+func (c headersCarrier) Get(key string) string {
+	value, _ := header(*c.msg, key)
+	return value
+}
+
+// Set replaces all headers with the key, so Get, which reads the last header, returns the value
+func (c headersCarrier) Set(key string, value string) {
+	headers := make([]kafka.Header, 0, len(c.msg.Headers)+1)
+	for _, h := range c.msg.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+
+	c.msg.Headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for i := range c.msg.Headers {
+		keys = append(keys, c.msg.Headers[i].Key)
+	}
+
+	return keys
+}
+
+// InjectContext puts trace context, request id and registered log fields of the context into message headers
+func InjectContext(ctx context.Context, msg *kafka.Message) {
+	infrapropagation.Inject(ctx, headersCarrier{msg: msg})
+}
+
+// ExtractContext restores trace context, request id and log fields from message headers
+func ExtractContext(ctx context.Context, msg kafka.Message) context.Context {
+	return infrapropagation.Extract(ctx, headersCarrier{msg: &msg})
+}
+
+// WithPropagation returns a handler that runs a given handler with the context restored from message headers
+func WithPropagation(handler Handler) Handler {
+	return func(ctx context.Context, msg kafka.Message) error {
+		return handler(ExtractContext(ctx, msg), msg)
+	}
+}
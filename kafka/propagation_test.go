@@ -0,0 +1,30 @@
+package infrakafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func Test_headersCarrier_Set(t *testing.T) {
+	msg := kafka.Message{Headers: []kafka.Header{
+		{Key: "x-request-id", Value: []byte("first")},
+		{Key: "other", Value: []byte("value")},
+		{Key: "x-request-id", Value: []byte("second")},
+	}}
+	carrier := headersCarrier{msg: &msg}
+
+	carrier.Set("x-request-id", "new")
+
+	if value := carrier.Get("x-request-id"); value != "new" {
+		t.Errorf("expected \"new\", got \"%s\"", value)
+	}
+
+	if len(msg.Headers) != 2 {
+		t.Fatalf("expected 2 headers, got %v", msg.Headers)
+	}
+
+	if msg.Headers[0].Key != "other" {
+		t.Errorf("expected other headers to be kept, got %v", msg.Headers)
+	}
+}
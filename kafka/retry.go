@@ -0,0 +1,334 @@
+package infrakafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Headers set on messages moved to retry and dead-letter topics
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderRetryAttempt      = "x-retry-attempt"
+)
+
+// Handler is a function that processes a single kafka message
+type Handler func(ctx context.Context, msg kafka.Message) error
+
+// RetryTopic returns the name of the n-th retry topic of a given topic
+func RetryTopic(topic string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, attempt)
+}
+
+// DeadLetterTopic returns the name of the dead-letter topic of a given topic
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// Retrier moves failed messages to retry topics and finally to the dead-letter topic.
+type Retrier struct {
+	topic  string
+	cfg    *RetryConfig
+	writer *kafka.Writer
+}
+
+// CreateRetrier creates a new retrier for a given source topic by a connection name
+func (cont *Container) CreateRetrier(connectionName string, topic string, cfg *RetryConfig) (*Retrier, error) {
+	kafkaConfig, err := cont.getConfig(connectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Retrier{
+		topic: topic,
+		cfg:   cfg,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(kafkaConfig.Brokers()...),
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  10,
+			Logger:       kafka.LoggerFunc(getLogFunc()),
+			ErrorLogger:  kafka.LoggerFunc(getLogErrorFunc()),
+		},
+	}, nil
+}
+
+// DeclareRetryTopics ensures retry and dead-letter topics of a given topic
+func (cont *Container) DeclareRetryTopics(ctx context.Context, connectionName string, topic string, cfg *RetryConfig) error {
+	kafkaConfig, err := cont.getConfig(connectionName)
+	if err != nil {
+		return err
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return err
+	}
+
+	specs := make(map[string]*TopicConfig, len(cfg.Delays)+1)
+	spec := &TopicConfig{
+		Partitions:        cfg.Partitions,
+		ReplicationFactor: cfg.ReplicationFactor,
+	}
+
+	for i := range cfg.Delays {
+		specs[RetryTopic(topic, i+1)] = spec
+	}
+	specs[DeadLetterTopic(topic)] = spec
+
+	return ensureTopics(ctx, kafkaConfig, specs)
+}
+
+// Fail moves a failed message to the next retry topic,
+// or to the dead-letter topic if all retries are exhausted.
+func (r *Retrier) Fail(ctx context.Context, msg kafka.Message, cause error) error {
+	attempt := retryAttempt(msg) + 1
+
+	next := DeadLetterTopic(r.topic)
+	if attempt <= len(r.cfg.Delays) {
+		next = RetryTopic(r.topic, attempt)
+	}
+
+	err := r.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   next,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: retryHeaders(msg, attempt, cause),
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't move message to \"%s\"", next)
+	}
+
+	return nil
+}
+
+// Wrap returns a handler that moves messages failed by a given handler to retry topics.
+// The returned handler fails only if the message can't be moved.
+func (r *Retrier) Wrap(handler Handler) Handler {
+	return func(ctx context.Context, msg kafka.Message) error {
+		err := handler(ctx, msg)
+		if err == nil {
+			return nil
+		}
+
+		infralog.Debug("kafka message failed",
+			zap.String("topic", msg.Topic),
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+			zap.Error(err))
+
+		return r.Fail(ctx, msg, err)
+	}
+}
+
+// Close closes the retrier's writer
+func (r *Retrier) Close() error {
+	return r.writer.Close()
+}
+
+// retryAttempt returns the number of retries the message has been through
+func retryAttempt(msg kafka.Message) int {
+	value, ok := header(msg, HeaderRetryAttempt)
+	if !ok {
+		return 0
+	}
+
+	attempt, err := strconv.Atoi(value)
+	if err != nil || attempt < 0 {
+		return 0
+	}
+
+	return attempt
+}
+
+// retryHeaders returns headers of a message moved to a retry or dead-letter topic.
+// Original topic, partition and offset are kept from the first failure.
+func retryHeaders(msg kafka.Message, attempt int, cause error) []kafka.Header {
+	ret := make([]kafka.Header, 0, len(msg.Headers)+5)
+	for _, h := range msg.Headers {
+		if h.Key == HeaderError || h.Key == HeaderRetryAttempt {
+			continue
+		}
+		ret = append(ret, h)
+	}
+
+	if _, ok := header(msg, HeaderOriginalTopic); !ok {
+		ret = append(ret,
+			kafka.Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+			kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		)
+	}
+
+	errText := ""
+	if cause != nil {
+		errText = cause.Error()
+	}
+
+	return append(ret,
+		kafka.Header{Key: HeaderError, Value: []byte(errText)},
+		kafka.Header{Key: HeaderRetryAttempt, Value: []byte(strconv.Itoa(attempt))},
+	)
+}
+
+func header(msg kafka.Message, key string) (string, bool) {
+	for i := len(msg.Headers) - 1; i >= 0; i-- {
+		if msg.Headers[i].Key == key {
+			return string(msg.Headers[i].Value), true
+		}
+	}
+
+	return "", false
+}
+
+// RetryConsumer processes messages from retry topics once their delay has passed.
+type RetryConsumer struct {
+	cfg     *RetryConfig
+	retrier *Retrier
+	handler Handler
+	readers []*kafka.Reader
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// CreateRetryConsumer creates a consumer of all retry topics of a given topic.
+// Messages that fail again are moved further by the retrier.
+func (cont *Container) CreateRetryConsumer(
+	connectionName string,
+	consumerGroup string,
+	topic string,
+	cfg *RetryConfig,
+	handler Handler,
+) (*RetryConsumer, error) {
+	retrier, err := cont.CreateRetrier(connectionName, topic, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kafkaConfig, err := cont.getConfig(connectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]*kafka.Reader, 0, len(cfg.Delays))
+	for i := range cfg.Delays {
+		readers = append(readers, kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     kafkaConfig.Brokers(),
+			GroupID:     consumerGroup,
+			Topic:       RetryTopic(topic, i+1),
+			StartOffset: kafka.FirstOffset,
+			Logger:      kafka.LoggerFunc(getLogFunc()),
+			ErrorLogger: kafka.LoggerFunc(getLogErrorFunc()),
+			MaxAttempts: 1000,
+		}))
+	}
+
+	return &RetryConsumer{
+		cfg:     cfg,
+		retrier: retrier,
+		handler: retrier.Wrap(handler),
+		readers: readers,
+	}, nil
+}
+
+// Start starts consuming retry topics in background
+func (c *RetryConsumer) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	for i := range c.readers {
+		c.wg.Add(1)
+		go func(reader *kafka.Reader, delay time.Duration) {
+			defer c.wg.Done()
+			c.consume(ctx, reader, delay)
+		}(c.readers[i], c.cfg.Delays[i])
+	}
+
+	return nil
+}
+
+// Stop stops consuming and waits until all consumer goroutines exit
+func (c *RetryConsumer) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	err := closeReaders(c.readers)
+	if closeErr := c.retrier.Close(); closeErr != nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (c *RetryConsumer) consume(ctx context.Context, reader *kafka.Reader, delay time.Duration) {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			infralog.Error("can't fetch kafka message", zap.String("topic", reader.Config().Topic), zap.Error(err))
+			continue
+		}
+
+		// messages in a retry topic are ordered by time,
+		// so it's safe to block the partition until the delay has passed
+		if wait := time.Until(msg.Time.Add(delay)); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		// do not commit the message until it's processed or moved further
+		for {
+			err = c.handler(ctx, msg)
+			if err == nil {
+				break
+			}
+
+			infralog.Error("can't process retried kafka message", zap.String("topic", msg.Topic), zap.Error(err))
+
+			select {
+			case <-time.After(handlerRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err = reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			infralog.Error("can't commit kafka message", zap.String("topic", msg.Topic), zap.Error(err))
+		}
+	}
+}
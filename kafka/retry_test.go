@@ -0,0 +1,73 @@
+package infrakafka
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+func Test_retryHeaders_firstFailure(t *testing.T) {
+	msg := kafka.Message{
+		Topic:     "events",
+		Partition: 3,
+		Offset:    42,
+		Headers:   []kafka.Header{{Key: "custom", Value: []byte("value")}},
+	}
+
+	msg.Headers = retryHeaders(msg, 1, errors.New("boom"))
+
+	expected := map[string]string{
+		"custom":                "value",
+		HeaderOriginalTopic:     "events",
+		HeaderOriginalPartition: "3",
+		HeaderOriginalOffset:    "42",
+		HeaderError:             "boom",
+		HeaderRetryAttempt:      "1",
+	}
+
+	for key, value := range expected {
+		if got, _ := header(msg, key); got != value {
+			t.Errorf("expected header %s = %q, got %q", key, value, got)
+		}
+	}
+
+	if retryAttempt(msg) != 1 {
+		t.Errorf("expected retry attempt 1, got %d", retryAttempt(msg))
+	}
+}
+
+func Test_retryHeaders_keepsOrigin(t *testing.T) {
+	msg := kafka.Message{Topic: "events", Partition: 3, Offset: 42}
+	msg.Headers = retryHeaders(msg, 1, errors.New("first"))
+
+	retried := kafka.Message{Topic: RetryTopic("events", 1), Partition: 0, Offset: 7, Headers: msg.Headers}
+	retried.Headers = retryHeaders(retried, 2, errors.New("second"))
+
+	if len(retried.Headers) != 5 {
+		t.Errorf("expected 5 headers, got %d", len(retried.Headers))
+	}
+
+	if got, _ := header(retried, HeaderOriginalTopic); got != "events" {
+		t.Errorf("expected original topic to be kept, got %q", got)
+	}
+
+	if got, _ := header(retried, HeaderOriginalOffset); got != "42" {
+		t.Errorf("expected original offset to be kept, got %q", got)
+	}
+
+	if got, _ := header(retried, HeaderError); got != "second" {
+		t.Errorf("expected last error, got %q", got)
+	}
+
+	if retryAttempt(retried) != 2 {
+		t.Errorf("expected retry attempt 2, got %d", retryAttempt(retried))
+	}
+}
+
+func Test_retryAttempt_invalid(t *testing.T) {
+	msg := kafka.Message{Headers: []kafka.Header{{Key: HeaderRetryAttempt, Value: []byte("abc")}}}
+	if retryAttempt(msg) != 0 {
+		t.Error("expected retry attempt 0")
+	}
+}
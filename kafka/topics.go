@@ -0,0 +1,408 @@
+package infrakafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// TopicDrift describes a difference between a declared topic and the actual one
+type TopicDrift struct {
+	Topic    string
+	Property string
+	Expected string
+	Actual   string
+}
+
+func (d TopicDrift) String() string {
+	return fmt.Sprintf("topic \"%s\": %s expected \"%s\", actual \"%s\"", d.Topic, d.Property, d.Expected, d.Actual)
+}
+
+const driftPropertyExists = "exists"
+
+// EnsureTopics creates topics declared in connection config if they don't exist,
+// adds missing partitions and updates topic configs.
+// Replication factor can't be changed this way, its drift is only logged.
+func (cont *Container) EnsureTopics(ctx context.Context, connectionName string) error {
+	kafkaConfig, err := cont.getConfig(connectionName)
+	if err != nil {
+		return err
+	}
+
+	return ensureTopics(ctx, kafkaConfig, kafkaConfig.Topics)
+}
+
+// CheckTopics compares topics declared in connection config with the actual ones
+// and returns found differences. It doesn't change anything.
+func (cont *Container) CheckTopics(ctx context.Context, connectionName string) ([]TopicDrift, error) {
+	kafkaConfig, err := cont.getConfig(connectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newAdminClient(kafkaConfig)
+
+	actual, err := describeTopics(ctx, client, kafkaConfig.Topics)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffTopics(kafkaConfig.Topics, actual), nil
+}
+
+// TopicsChecker verifies that all topics declared in connection config exist
+type TopicsChecker struct {
+	cont           *Container
+	connectionName string
+}
+
+var _ infraoperator.Checker = (*TopicsChecker)(nil)
+
+// TopicsChecker creates operator checker of topics declared in connection config
+func (cont *Container) TopicsChecker(connectionName string) *TopicsChecker {
+	return &TopicsChecker{
+		cont:           cont,
+		connectionName: connectionName,
+	}
+}
+
+func (c *TopicsChecker) Check(ctx context.Context) error {
+	kafkaConfig, err := c.cont.getConfig(c.connectionName)
+	if err != nil {
+		return err
+	}
+
+	existing, err := listTopics(ctx, newAdminClient(kafkaConfig), topicNames(kafkaConfig.Topics))
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for name := range kafkaConfig.Topics {
+		if _, ok := existing[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("missing kafka topics: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// TopicsEnsurer ensures topics declared in connection config on start
+type TopicsEnsurer struct {
+	cont           *Container
+	connectionName string
+}
+
+var _ infraoperator.Starter = (*TopicsEnsurer)(nil)
+
+// TopicsEnsurer creates operator starter which runs EnsureTopics, so topics exist before consumers and producers start
+func (cont *Container) TopicsEnsurer(connectionName string) *TopicsEnsurer {
+	return &TopicsEnsurer{
+		cont:           cont,
+		connectionName: connectionName,
+	}
+}
+
+func (e *TopicsEnsurer) Start(ctx context.Context) error {
+	return e.cont.EnsureTopics(ctx, e.connectionName)
+}
+
+// topicState holds actual topic parameters
+type topicState struct {
+	partitions        int
+	replicationFactor int
+	configs           map[string]string
+}
+
+func newAdminClient(cfg *ConnectionConfig) *kafka.Client {
+	return &kafka.Client{Addr: kafka.TCP(cfg.Brokers()...)}
+}
+
+func ensureTopics(ctx context.Context, cfg *ConnectionConfig, specs map[string]*TopicConfig) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	client := newAdminClient(cfg)
+
+	actual, err := describeTopics(ctx, client, specs)
+	if err != nil {
+		return err
+	}
+
+	var (
+		create       []kafka.TopicConfig
+		partitions   []kafka.TopicPartitionsConfig
+		configDrifts []TopicDrift
+	)
+
+	for _, drift := range diffTopics(specs, actual) {
+		spec := specs[drift.Topic]
+
+		switch {
+		case drift.Property == driftPropertyExists:
+			create = append(create, createTopicConfig(drift.Topic, spec))
+		case drift.Property == "partitions" && actual[drift.Topic].partitions < spec.Partitions:
+			partitions = append(partitions, kafka.TopicPartitionsConfig{
+				Name:  drift.Topic,
+				Count: int32(spec.Partitions),
+			})
+		case strings.HasPrefix(drift.Property, "config "):
+			configDrifts = append(configDrifts, drift)
+		default:
+			infralog.Warn("kafka topic drift can't be fixed automatically", zap.String("drift", drift.String()))
+		}
+	}
+
+	if len(create) > 0 {
+		resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: create})
+		if err != nil {
+			return errors.Wrap(err, "create topics")
+		}
+
+		for name, err := range resp.Errors {
+			if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+				return errors.Wrapf(err, "create topic \"%s\"", name)
+			}
+		}
+	}
+
+	if len(partitions) > 0 {
+		resp, err := client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{Topics: partitions})
+		if err != nil {
+			return errors.Wrap(err, "create partitions")
+		}
+
+		for name, err := range resp.Errors {
+			if err != nil {
+				return errors.Wrapf(err, "create partitions of topic \"%s\"", name)
+			}
+		}
+	}
+
+	if alter := alterConfigsResources(configDrifts); len(alter) > 0 {
+		resp, err := client.IncrementalAlterConfigs(ctx, &kafka.IncrementalAlterConfigsRequest{Resources: alter})
+		if err != nil {
+			return errors.Wrap(err, "alter topic configs")
+		}
+
+		for _, res := range resp.Resources {
+			if res.Error != nil {
+				return errors.Wrapf(res.Error, "alter configs of topic \"%s\"", res.ResourceName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// alterConfigsResources groups config drifts by topic, so every topic is altered by a single resource.
+// Brokers reject requests with duplicate resources.
+func alterConfigsResources(drifts []TopicDrift) []kafka.IncrementalAlterConfigsRequestResource {
+	var ret []kafka.IncrementalAlterConfigsRequestResource
+	index := make(map[string]int)
+	for _, drift := range drifts {
+		i, ok := index[drift.Topic]
+		if !ok {
+			i = len(ret)
+			index[drift.Topic] = i
+			ret = append(ret, kafka.IncrementalAlterConfigsRequestResource{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: drift.Topic,
+			})
+		}
+
+		ret[i].Configs = append(ret[i].Configs, kafka.IncrementalAlterConfigsRequestConfig{
+			Name:            strings.TrimPrefix(drift.Property, "config "),
+			Value:           drift.Expected,
+			ConfigOperation: kafka.ConfigOperationSet,
+		})
+	}
+
+	return ret
+}
+
+func createTopicConfig(name string, spec *TopicConfig) kafka.TopicConfig {
+	ret := kafka.TopicConfig{
+		Topic:             name,
+		NumPartitions:     -1,
+		ReplicationFactor: -1,
+	}
+
+	if spec.Partitions > 0 {
+		ret.NumPartitions = spec.Partitions
+	}
+
+	if spec.ReplicationFactor > 0 {
+		ret.ReplicationFactor = spec.ReplicationFactor
+	}
+
+	for name, value := range spec.configEntries() {
+		ret.ConfigEntries = append(ret.ConfigEntries, kafka.ConfigEntry{ConfigName: name, ConfigValue: value})
+	}
+
+	return ret
+}
+
+func topicNames(specs map[string]*TopicConfig) []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// listTopics returns metadata of existing topics among given ones
+func listTopics(ctx context.Context, client *kafka.Client, names []string) (map[string]kafka.Topic, error) {
+	resp, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: names})
+	if err != nil {
+		return nil, errors.Wrap(err, "metadata")
+	}
+
+	ret := make(map[string]kafka.Topic, len(resp.Topics))
+	for _, topic := range resp.Topics {
+		if topic.Error != nil {
+			if errors.Is(topic.Error, kafka.UnknownTopicOrPartition) {
+				continue
+			}
+
+			return nil, errors.Wrapf(topic.Error, "metadata of topic \"%s\"", topic.Name)
+		}
+
+		ret[topic.Name] = topic
+	}
+
+	return ret, nil
+}
+
+// describeTopics returns actual state of existing topics among declared ones.
+// Only configs that are set in specs are fetched.
+func describeTopics(ctx context.Context, client *kafka.Client, specs map[string]*TopicConfig) (map[string]*topicState, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	existing, err := listTopics(ctx, client, topicNames(specs))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]*topicState, len(existing))
+	var resources []kafka.DescribeConfigRequestResource
+	for name, topic := range existing {
+		state := &topicState{
+			partitions: len(topic.Partitions),
+			configs:    make(map[string]string),
+		}
+		if len(topic.Partitions) > 0 {
+			state.replicationFactor = len(topic.Partitions[0].Replicas)
+		}
+		ret[name] = state
+
+		configNames := make([]string, 0)
+		for configName := range specs[name].configEntries() {
+			configNames = append(configNames, configName)
+		}
+
+		if len(configNames) > 0 {
+			resources = append(resources, kafka.DescribeConfigRequestResource{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: name,
+				ConfigNames:  configNames,
+			})
+		}
+	}
+
+	if len(resources) == 0 {
+		return ret, nil
+	}
+
+	resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+	if err != nil {
+		return nil, errors.Wrap(err, "describe topic configs")
+	}
+
+	for _, res := range resp.Resources {
+		if res.Error != nil {
+			return nil, errors.Wrapf(res.Error, "describe configs of topic \"%s\"", res.ResourceName)
+		}
+
+		state, ok := ret[res.ResourceName]
+		if !ok {
+			continue
+		}
+
+		for _, entry := range res.ConfigEntries {
+			state.configs[entry.ConfigName] = entry.ConfigValue
+		}
+	}
+
+	return ret, nil
+}
+
+// diffTopics compares declared topics with their actual state
+func diffTopics(specs map[string]*TopicConfig, actual map[string]*topicState) []TopicDrift {
+	var ret []TopicDrift
+	for _, name := range topicNames(specs) {
+		spec := specs[name]
+
+		state, ok := actual[name]
+		if !ok {
+			ret = append(ret, TopicDrift{Topic: name, Property: driftPropertyExists, Expected: "true", Actual: "false"})
+			continue
+		}
+
+		if spec.Partitions > 0 && spec.Partitions != state.partitions {
+			ret = append(ret, TopicDrift{
+				Topic:    name,
+				Property: "partitions",
+				Expected: strconv.Itoa(spec.Partitions),
+				Actual:   strconv.Itoa(state.partitions),
+			})
+		}
+
+		if spec.ReplicationFactor > 0 && spec.ReplicationFactor != state.replicationFactor {
+			ret = append(ret, TopicDrift{
+				Topic:    name,
+				Property: "replication_factor",
+				Expected: strconv.Itoa(spec.ReplicationFactor),
+				Actual:   strconv.Itoa(state.replicationFactor),
+			})
+		}
+
+		entries := spec.configEntries()
+		configNames := make([]string, 0, len(entries))
+		for configName := range entries {
+			configNames = append(configNames, configName)
+		}
+		sort.Strings(configNames)
+
+		for _, configName := range configNames {
+			if state.configs[configName] != entries[configName] {
+				ret = append(ret, TopicDrift{
+					Topic:    name,
+					Property: "config " + configName,
+					Expected: entries[configName],
+					Actual:   state.configs[configName],
+				})
+			}
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,74 @@
+package infrakafka
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_diffTopics(t *testing.T) {
+	specs := map[string]*TopicConfig{
+		"missing": {Partitions: 3},
+		"events": {
+			Partitions:        6,
+			ReplicationFactor: 3,
+			Retention:         time.Hour,
+			CleanupPolicy:     "delete",
+		},
+		"in_sync": {Partitions: 1},
+	}
+
+	actual := map[string]*topicState{
+		"events": {
+			partitions:        3,
+			replicationFactor: 3,
+			configs: map[string]string{
+				"retention.ms":   "60000",
+				"cleanup.policy": "delete",
+			},
+		},
+		"in_sync": {partitions: 1, replicationFactor: 1},
+	}
+
+	drifts := diffTopics(specs, actual)
+
+	expected := []TopicDrift{
+		{Topic: "events", Property: "partitions", Expected: "6", Actual: "3"},
+		{Topic: "events", Property: "config retention.ms", Expected: "3600000", Actual: "60000"},
+		{Topic: "missing", Property: driftPropertyExists, Expected: "true", Actual: "false"},
+	}
+
+	if len(drifts) != len(expected) {
+		t.Fatalf("expected %d drifts, got %v", len(expected), drifts)
+	}
+
+	for i := range expected {
+		if drifts[i] != expected[i] {
+			t.Errorf("expected drift %v, got %v", expected[i], drifts[i])
+		}
+	}
+}
+
+func Test_alterConfigsResources(t *testing.T) {
+	drifts := []TopicDrift{
+		{Topic: "events", Property: "config retention.ms", Expected: "3600000", Actual: "60000"},
+		{Topic: "events", Property: "config cleanup.policy", Expected: "compact", Actual: "delete"},
+		{Topic: "logs", Property: "config retention.ms", Expected: "60000", Actual: "3600000"},
+	}
+
+	resources := alterConfigsResources(drifts)
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+
+	if resources[0].ResourceName != "events" || len(resources[0].Configs) != 2 {
+		t.Errorf("expected 2 configs of \"events\", got %v", resources[0])
+	}
+
+	if resources[0].Configs[1].Name != "cleanup.policy" || resources[0].Configs[1].Value != "compact" {
+		t.Errorf("unexpected config %v", resources[0].Configs[1])
+	}
+
+	if resources[1].ResourceName != "logs" || len(resources[1].Configs) != 1 {
+		t.Errorf("expected 1 config of \"logs\", got %v", resources[1])
+	}
+}
@@ -0,0 +1,340 @@
+package infraleader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRetryInterval = 5 * time.Second
+	defaultRenewInterval = 2 * time.Second
+	serviceStopTimeout   = 30 * time.Second
+
+	// leaseRenewals is the number of renew intervals a lease lasts for backends without TTL
+	leaseRenewals = 5
+)
+
+// Backend acquires and holds leadership
+type Backend interface {
+	// TryAcquire tries to become the leader without blocking. Returns true if leadership is acquired
+	TryAcquire(ctx context.Context) (bool, error)
+
+	// Renew extends leadership. Returns false if it's lost
+	Renew(ctx context.Context) (bool, error)
+
+	// Release gives leadership up
+	Release(ctx context.Context) error
+}
+
+// ttlBackend is a backend whose leadership expires unless it's renewed within TTL
+type ttlBackend interface {
+	TTL() time.Duration
+}
+
+type Config struct {
+	// Interval of acquire attempts while not being the leader. Default is 5s
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+
+	// Interval of leadership renewals. It must be much less than a lease TTL of the backend. Default is 2s
+	RenewInterval time.Duration `mapstructure:"renew_interval"`
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.RetryInterval < 0 || c.RenewInterval < 0 {
+		return errors.New("intervals must not be negative")
+	}
+
+	return nil
+}
+
+// Elector campaigns for leadership and runs leader-only services while being the leader.
+// Leadership is given up if a renewal fails, so the other instance may take it over.
+// The lease is tracked locally: if leadership isn't renewed within the backend TTL
+// (5 renew intervals for backends without TTL) since the last successful attempt started,
+// it's considered lost even if the backend doesn't respond.
+type Elector struct {
+	backend       Backend
+	retryInterval time.Duration
+	renewInterval time.Duration
+	leaseTTL      time.Duration
+
+	mu        sync.Mutex
+	onElected []func(ctx context.Context)
+	onRevoked []func()
+	services  []interface{}
+
+	leader   atomic.Bool
+	operator *infraoperator.Operator
+	started  []interface{}
+
+	leaderCancel context.CancelFunc
+	leaderWg     sync.WaitGroup
+	// leaseTimer cancels the leader context when the lease expires
+	leaseTimer    *time.Timer
+	leaseDeadline time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	_ infraoperator.Starter = (*Elector)(nil)
+	_ infraoperator.Stopper = (*Elector)(nil)
+)
+
+// New creates a new elector. cfg may be nil
+func New(backend Backend, cfg *Config) *Elector {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	retryInterval := cfg.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	renewInterval := cfg.RenewInterval
+	if renewInterval <= 0 {
+		renewInterval = defaultRenewInterval
+	}
+
+	leaseTTL := leaseRenewals * renewInterval
+	if b, ok := backend.(ttlBackend); ok {
+		leaseTTL = b.TTL()
+	}
+
+	return &Elector{
+		backend:       backend,
+		retryInterval: retryInterval,
+		renewInterval: renewInterval,
+		leaseTTL:      leaseTTL,
+		operator:      &infraoperator.Operator{},
+	}
+}
+
+// OnElected adds a callback run in background when leadership is acquired.
+// Its context is cancelled when leadership is lost. Leadership is released without waiting for the callback,
+// so it must return promptly once the context is cancelled.
+func (e *Elector) OnElected(fn func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.onElected = append(e.onElected, fn)
+}
+
+// OnRevoked adds a callback run when leadership is lost or given up on Stop
+func (e *Elector) OnRevoked(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.onRevoked = append(e.onRevoked, fn)
+}
+
+// AddService adds a leader-only service. It's started by the operator when leadership is acquired
+// and stopped in reverse order when it's lost. The service must support being started again after a stop.
+// Leadership is released before services are stopped, so they must not rely on being the only leader while stopping.
+func (e *Elector) AddService(service interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.services = append(e.services, service)
+}
+
+// IsLeader returns true if the instance is the leader now
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Start starts campaigning in background
+func (e *Elector) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.run(ctx)
+	}()
+
+	return nil
+}
+
+// Stop stops campaigning and gives leadership up
+func (e *Elector) Stop(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Elector) run(ctx context.Context) {
+	leading := false
+	defer func() {
+		if leading {
+			e.revoke()
+		}
+	}()
+
+	for {
+		interval := e.retryInterval
+		start := time.Now()
+
+		if leading {
+			interval = e.renewInterval
+
+			ok, err := e.renew(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil && ok {
+				ok = e.extendLease(start)
+			}
+			if err != nil || !ok {
+				infralog.Warn("leadership lost", zap.Error(err))
+				e.revoke()
+				leading = false
+				interval = e.retryInterval
+			}
+		} else {
+			ok, err := e.backend.TryAcquire(ctx)
+			if err != nil && ctx.Err() == nil {
+				infralog.Error("can't acquire leadership", zap.Error(err))
+			}
+			if ok {
+				leading = true
+				if err = e.elect(ctx, start); err != nil {
+					infralog.Error("can't start leader services", zap.Error(err))
+					e.revoke()
+					leading = false
+				} else {
+					interval = e.renewInterval
+				}
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// renew renews leadership. It gives up when the lease expires, since the renewal is useless after that
+func (e *Elector) renew(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithDeadline(ctx, e.leaseDeadline)
+	defer cancel()
+
+	return e.backend.Renew(ctx)
+}
+
+// extendLease moves the lease deadline after a successful renewal started at a given time.
+// Returns false if the lease has already expired.
+func (e *Elector) extendLease(start time.Time) bool {
+	if !e.leaseTimer.Stop() {
+		return false
+	}
+
+	e.leaseDeadline = start.Add(e.leaseTTL)
+	e.leaseTimer.Reset(time.Until(e.leaseDeadline))
+
+	return true
+}
+
+func (e *Elector) elect(ctx context.Context, start time.Time) error {
+	infralog.Info("leadership acquired")
+
+	e.mu.Lock()
+	services := e.services
+	onElected := e.onElected
+	e.mu.Unlock()
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.leaderCancel = cancel
+	e.leader.Store(true)
+
+	e.leaseDeadline = start.Add(e.leaseTTL)
+	e.leaseTimer = time.AfterFunc(time.Until(e.leaseDeadline), func() {
+		infralog.Warn("leadership lease expired")
+		e.leader.Store(false)
+		cancel()
+	})
+
+	for _, fn := range onElected {
+		e.leaderWg.Add(1)
+		go func(fn func(ctx context.Context)) {
+			defer e.leaderWg.Done()
+			fn(leaderCtx)
+		}(fn)
+	}
+
+	for _, service := range services {
+		if err := e.operator.AddService(leaderCtx, service); err != nil {
+			return err
+		}
+		e.started = append(e.started, service)
+	}
+
+	return nil
+}
+
+// revoke cancels the leader context, releases leadership, then stops leader services and waits for OnElected callbacks
+func (e *Elector) revoke() {
+	e.leader.Store(false)
+	e.leaseTimer.Stop()
+	e.leaderCancel()
+
+	// the lease expires by itself after TTL, so there is no point to wait longer
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), e.leaseTTL)
+	defer releaseCancel()
+
+	if err := e.backend.Release(releaseCtx); err != nil {
+		infralog.Error("can't release leadership", zap.Error(err))
+	}
+
+	infralog.Info("leadership released")
+
+	e.mu.Lock()
+	onRevoked := e.onRevoked
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), serviceStopTimeout)
+	defer cancel()
+
+	for i := len(e.started) - 1; i >= 0; i-- {
+		if err := e.operator.RemoveService(ctx, e.started[i]); err != nil {
+			infralog.Error("can't stop leader service", zap.Error(err))
+		}
+	}
+	e.started = nil
+
+	e.leaderWg.Wait()
+
+	for _, fn := range onRevoked {
+		fn()
+	}
+}
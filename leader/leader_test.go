@@ -0,0 +1,245 @@
+package infraleader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeBackend struct {
+	mu       sync.Mutex
+	free     bool
+	held     bool
+	stalled  bool
+	released int
+}
+
+func (b *fakeBackend) TryAcquire(context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.free {
+		return false, nil
+	}
+	b.free = false
+	b.held = true
+
+	return true, nil
+}
+
+func (b *fakeBackend) Renew(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	stalled := b.stalled
+	b.mu.Unlock()
+
+	if stalled {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.held, nil
+}
+
+func (b *fakeBackend) Release(context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.held = false
+	b.released++
+
+	return nil
+}
+
+// lose simulates leadership taken over by another instance
+func (b *fakeBackend) lose() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.held = false
+}
+
+func (b *fakeBackend) releases() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.released
+}
+
+// ttlFakeBackend is a backend whose lease expires after ttl
+type ttlFakeBackend struct {
+	*fakeBackend
+	ttl time.Duration
+}
+
+func (b *ttlFakeBackend) TTL() time.Duration { return b.ttl }
+
+type fakeService struct {
+	started atomic.Int32
+	stopped atomic.Int32
+}
+
+func (s *fakeService) Start(context.Context) error {
+	s.started.Add(1)
+	return nil
+}
+
+func (s *fakeService) Stop(context.Context) error {
+	s.stopped.Add(1)
+	return nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_Elector(t *testing.T) {
+	backend := &fakeBackend{free: true}
+	service := &fakeService{}
+
+	e := New(backend, &Config{RetryInterval: time.Millisecond, RenewInterval: time.Millisecond})
+	e.AddService(service)
+
+	var electedCtx atomic.Value
+	var revoked atomic.Int32
+	e.OnElected(func(ctx context.Context) {
+		electedCtx.Store(ctx)
+		<-ctx.Done()
+	})
+	e.OnRevoked(func() {
+		revoked.Add(1)
+	})
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "election", func() bool { return e.IsLeader() && service.started.Load() == 1 })
+
+	backend.lose()
+
+	waitFor(t, "revocation", func() bool { return revoked.Load() == 1 })
+
+	if e.IsLeader() {
+		t.Error("elector is still the leader")
+	}
+	if service.stopped.Load() != 1 {
+		t.Errorf("service stopped %d times, want 1", service.stopped.Load())
+	}
+	if ctx := electedCtx.Load().(context.Context); ctx.Err() == nil {
+		t.Error("leader context is not cancelled")
+	}
+
+	// leadership is acquired again once it's free
+	backend.mu.Lock()
+	backend.free = true
+	backend.mu.Unlock()
+
+	waitFor(t, "re-election", func() bool { return e.IsLeader() && service.started.Load() == 2 })
+
+	if err := e.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked.Load() != 2 || service.stopped.Load() != 2 {
+		t.Errorf("revoked %d times, service stopped %d times, want 2", revoked.Load(), service.stopped.Load())
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.released != 2 {
+		t.Errorf("released %d times, want 2", backend.released)
+	}
+}
+
+func Test_Elector_leaseExpiresWhileRenewStalls(t *testing.T) {
+	backend := &ttlFakeBackend{fakeBackend: &fakeBackend{free: true}, ttl: 100 * time.Millisecond}
+
+	e := New(backend, &Config{RetryInterval: time.Hour, RenewInterval: 10 * time.Millisecond})
+
+	elected := make(chan context.Context, 1)
+	e.OnElected(func(ctx context.Context) {
+		elected <- ctx
+		<-ctx.Done()
+	})
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = e.Stop(context.Background()) }()
+
+	leaderCtx := <-elected
+
+	backend.mu.Lock()
+	backend.stalled = true
+	backend.mu.Unlock()
+	stalledAt := time.Now()
+
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leader context is not cancelled after the lease expired")
+	}
+
+	// another instance may take the lease over after TTL since the last renewal, allow for timer latency
+	if elapsed := time.Since(stalledAt); elapsed > backend.ttl+20*time.Millisecond {
+		t.Errorf("leader context is cancelled after %s, lease TTL is %s", elapsed, backend.ttl)
+	}
+
+	if e.IsLeader() {
+		t.Error("elector is still the leader")
+	}
+
+	waitFor(t, "release", func() bool { return backend.releases() == 1 })
+}
+
+func Test_Elector_releasesWithoutWaitingForCallbacks(t *testing.T) {
+	backend := &fakeBackend{free: true}
+
+	e := New(backend, &Config{RetryInterval: time.Millisecond, RenewInterval: time.Millisecond})
+
+	elected := make(chan struct{})
+	finish := make(chan struct{})
+	e.OnElected(func(ctx context.Context) {
+		close(elected)
+		<-finish
+	})
+
+	if err := e.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	<-elected
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- e.Stop(context.Background())
+	}()
+
+	// the callback ignores the cancelled context, but leadership is released anyway
+	waitFor(t, "release", func() bool { return backend.releases() == 1 })
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the callback")
+	default:
+	}
+
+	close(finish)
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,81 @@
+package infraleader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/postgres"
+)
+
+// PostgresBackend holds leadership by a session-level advisory lock on a dedicated connection.
+// The lock is released by the server if the connection is lost.
+type PostgresBackend struct {
+	db   *sql.DB
+	key  string
+	conn *sql.Conn
+}
+
+var _ Backend = (*PostgresBackend)(nil)
+
+// NewPostgresBackend creates a backend of a named postgres connection. key identifies the lock
+func NewPostgresBackend(cont *infrapostgres.Container, connectionName string, key string) (*PostgresBackend, error) {
+	db := cont.Get(connectionName)
+	if db == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	return &PostgresBackend{
+		db:  db,
+		key: key,
+	}, nil
+}
+
+func (b *PostgresBackend) TryAcquire(ctx context.Context) (bool, error) {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "get connection")
+	}
+
+	var acquired bool
+	if err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, b.key).Scan(&acquired); err != nil || !acquired {
+		_ = conn.Close()
+		return false, err
+	}
+
+	b.conn = conn
+
+	return true, nil
+}
+
+func (b *PostgresBackend) Renew(ctx context.Context) (bool, error) {
+	if b.conn == nil {
+		return false, nil
+	}
+
+	// the lock is held as long as the session is alive
+	if err := b.conn.PingContext(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *PostgresBackend) Release(ctx context.Context) error {
+	if b.conn == nil {
+		return nil
+	}
+
+	conn := b.conn
+	b.conn = nil
+
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, b.key)
+	if err != nil {
+		// closing the connection doesn't guarantee the session ends, so drop it from the pool
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	_ = conn.Close()
+
+	return err
+}
@@ -0,0 +1,86 @@
+package infraleader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+// renewScript extends the lease only if it's still held by the token
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript deletes the lease only if it's still held by the token
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// RedisBackend holds leadership by a key with TTL that is renewed by the leader
+type RedisBackend struct {
+	client redis.UniversalClient
+	key    string
+	ttl    time.Duration
+	token  string
+}
+
+var (
+	_ Backend    = (*RedisBackend)(nil)
+	_ ttlBackend = (*RedisBackend)(nil)
+)
+
+// NewRedisBackend creates a backend of a named redis connection.
+// The lease expires after ttl unless renewed, so ttl must be several times longer than the renew interval.
+func NewRedisBackend(cont *infraredis.Container, connectionName string, key string, ttl time.Duration) (*RedisBackend, error) {
+	client := cont.Get(connectionName)
+	if client == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be greater than zero")
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, errors.Wrap(err, "generate token")
+	}
+
+	return &RedisBackend{
+		client: client,
+		key:    key,
+		ttl:    ttl,
+		token:  hex.EncodeToString(token),
+	}, nil
+}
+
+// TTL returns the lease TTL. The elector considers leadership lost if it's not renewed within TTL
+func (b *RedisBackend) TTL() time.Duration {
+	return b.ttl
+}
+
+func (b *RedisBackend) TryAcquire(ctx context.Context) (bool, error) {
+	return b.client.SetNX(ctx, b.key, b.token, b.ttl).Result()
+}
+
+func (b *RedisBackend) Renew(ctx context.Context) (bool, error) {
+	renewed, err := renewScript.Run(ctx, b.client, []string{b.key}, b.token, b.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return renewed == 1, nil
+}
+
+func (b *RedisBackend) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, b.client, []string{b.key}, b.token).Err()
+}
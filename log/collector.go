@@ -88,6 +88,11 @@ func fieldsFromContext(ctx context.Context) []zap.Field {
 	return nil
 }
 
+// FieldsFromContext returns log fields stored in the context
+func FieldsFromContext(ctx context.Context) []zap.Field {
+	return fieldsFromContext(ctx)
+}
+
 func WithField(ctx context.Context, field zap.Field) context.Context {
 	ctxFields, ok := ctx.Value(fieldsCtxKey).(*logFields)
 	if !ok || ctxFields == nil {
@@ -108,6 +113,18 @@ func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
 	return ctx
 }
 
+// ChildWithFields returns a child context with a copy of parent's log fields and given ones.
+// Unlike WithFields, it never modifies fields of the parent context.
+func ChildWithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	parentFields := fieldsFromContext(ctx)
+
+	ctxFields := &logFields{fields: make([]zap.Field, 0, len(parentFields)+len(fields))}
+	ctxFields.fields = append(ctxFields.fields, parentFields...)
+	ctxFields.fields = append(ctxFields.fields, fields...)
+
+	return context.WithValue(ctx, fieldsCtxKey, ctxFields)
+}
+
 func RegisterLogHandler(handler LogHandler) {
 	// add handler to the beginning of the handlers list to
 	// make it the first one to be called
@@ -0,0 +1,192 @@
+package inframigrate
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/clickhouse"
+)
+
+// OnClusterPlaceholder is replaced in ClickHouse migrations with "ON CLUSTER <cluster>" or removed if no cluster is set
+const OnClusterPlaceholder = "{on_cluster}"
+
+// NewClickHouse creates a migrator of a named clickhouse connection.
+// ClickHouse has neither transactions nor advisory locks, so statements of a migration are applied one by one
+// and concurrent runs are not prevented, see the package doc.
+// With a cluster set, the versions table is a ReplicatedMergeTree, so the server must have default replica path configured.
+// Versions are inserted on the shard of the connection only, so with several shards the migrator must always
+// be run against the same shard, otherwise migrations are applied again.
+func NewClickHouse(cont *infraclickhouse.Container, connectionName string, fsys fs.FS, cfg *Config) (*Migrator, error) {
+	db := cont.Get(connectionName)
+	if db == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	return newMigrator(db, fsys, cfg, func(table string, cluster string) dialect {
+		return &clickhouseDialect{
+			table:   quoteClickHouseIdentifier(table),
+			cluster: cluster,
+		}
+	})
+}
+
+type clickhouseDialect struct {
+	table   string
+	cluster string
+}
+
+func (d *clickhouseDialect) onCluster() string {
+	if d.cluster == "" {
+		return ""
+	}
+
+	return "ON CLUSTER `" + d.cluster + "`"
+}
+
+func (d *clickhouseDialect) createTable(ctx context.Context, conn *sql.Conn) error {
+	engine := "MergeTree"
+	if d.cluster != "" {
+		engine = "ReplicatedMergeTree"
+	}
+
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.table+` `+d.onCluster()+` (
+		version Int64,
+		name String,
+		applied_at DateTime DEFAULT now()
+	) ENGINE = `+engine+` ORDER BY version`)
+
+	return err
+}
+
+func (d *clickhouseDialect) tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var exists uint8
+	err := conn.QueryRowContext(ctx, `EXISTS TABLE `+d.table).Scan(&exists)
+
+	return exists == 1, err
+}
+
+func (d *clickhouseDialect) lock(context.Context, *sql.Conn) error {
+	return nil
+}
+
+func (d *clickhouseDialect) unlock(context.Context, *sql.Conn) error {
+	return nil
+}
+
+// applied returns applied versions. The table engine doesn't deduplicate rows,
+// so duplicates of concurrent runs are collapsed by the map.
+func (d *clickhouseDialect) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM `+d.table+``)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (d *clickhouseDialect) apply(ctx context.Context, conn *sql.Conn, m *Migration, query string) error {
+	query = strings.ReplaceAll(query, OnClusterPlaceholder, d.onCluster())
+
+	for _, statement := range splitStatements(query) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.ExecContext(ctx, `INSERT INTO `+d.table+` (version, name) VALUES (?, ?)`, m.Version, m.Name)
+
+	return errors.Wrap(err, "record version")
+}
+
+func quoteClickHouseIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.ReplaceAll(part, "`", "``") + "`"
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// splitStatements splits a script by semicolons outside of quotes and comments. Empty statements are dropped.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		start      int
+	)
+
+	add := func(end int) {
+		if statement := strings.TrimSpace(script[start:end]); statement != "" && !isComment(statement) {
+			statements = append(statements, statement)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' {
+					i++
+				}
+			}
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			add(i)
+		}
+	}
+
+	if start < len(script) {
+		add(len(script))
+	}
+
+	return statements
+}
+
+// isComment returns true if a statement consists of comments only
+func isComment(statement string) bool {
+	for i := 0; i < len(statement); i++ {
+		switch {
+		case strings.HasPrefix(statement[i:], "--"):
+			for i < len(statement) && statement[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				return true
+			}
+			i += end + 3
+		case !strings.ContainsRune(" \t\r\n", rune(statement[i])):
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,290 @@
+// Package inframigrate applies versioned SQL migrations embedded into a binary.
+//
+// Postgres migrations are run under an advisory lock, so only one instance applies them at a time.
+// ClickHouse has no locks: instances started at the same time may apply the same migration twice,
+// and a failed statement leaves the previous ones applied. Run ClickHouse migrations from a single instance,
+// e.g. a job, and keep statements idempotent, e.g. "CREATE TABLE IF NOT EXISTS".
+package inframigrate
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+const defaultTable = "schema_migrations"
+
+type Config struct {
+	// Directory of migration files in the file system. Root is used if not set
+	Dir string `mapstructure:"dir"`
+
+	// Table of applied versions. Default is "schema_migrations"
+	Table string `mapstructure:"table"`
+
+	// ClickHouse cluster name. If set, the versions table is created ON CLUSTER
+	// and "{on_cluster}" placeholder in migrations is replaced with "ON CLUSTER <cluster>"
+	Cluster string `mapstructure:"cluster"`
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if strings.ContainsAny(c.Cluster, "`") {
+		return errors.New("invalid cluster name")
+	}
+
+	return nil
+}
+
+// Migration is a versioned SQL file named "<version>_<name>.sql", e.g. "0001_create_users.sql"
+type Migration struct {
+	Version int64
+	Name    string
+
+	// Applied is true if the migration is recorded in the versions table
+	Applied   bool
+	AppliedAt time.Time
+
+	file string
+}
+
+// dialect implements database specific parts of migrations
+type dialect interface {
+	// createTable creates the versions table if it doesn't exist
+	createTable(ctx context.Context, conn *sql.Conn) error
+
+	// tableExists returns true if the versions table exists
+	tableExists(ctx context.Context, conn *sql.Conn) (bool, error)
+
+	// lock prevents concurrent migrations until unlock is called
+	lock(ctx context.Context, conn *sql.Conn) error
+	unlock(ctx context.Context, conn *sql.Conn) error
+
+	// applied returns applied versions and their apply time
+	applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error)
+
+	// apply runs a migration and records its version
+	apply(ctx context.Context, conn *sql.Conn, m *Migration, query string) error
+}
+
+// Migrator applies SQL migrations from a file system, typically embed.FS
+type Migrator struct {
+	db      *sql.DB
+	fsys    fs.FS
+	dialect dialect
+}
+
+var _ infraoperator.Starter = (*Migrator)(nil)
+
+func newMigrator(db *sql.DB, fsys fs.FS, cfg *Config, newDialect func(table string, cluster string) dialect) (*Migrator, error) {
+	if db == nil {
+		return nil, errors.New("connection is nil")
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Dir != "" && cfg.Dir != "." {
+		sub, err := fs.Sub(fsys, cfg.Dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "dir \"%s\"", cfg.Dir)
+		}
+		fsys = sub
+	}
+
+	table := cfg.Table
+	if table == "" {
+		table = defaultTable
+	}
+
+	return &Migrator{
+		db:      db,
+		fsys:    fsys,
+		dialect: newDialect(table, cfg.Cluster),
+	}, nil
+}
+
+// Start applies pending migrations. It allows to run migrations by the operator on startup.
+func (m *Migrator) Start(ctx context.Context) error {
+	return m.Up(ctx)
+}
+
+// Up applies all pending migrations in version order. Each migration is recorded right after it is applied.
+func (m *Migrator) Up(ctx context.Context) error {
+	migrations, err := loadMigrations(m.fsys)
+	if err != nil {
+		return err
+	}
+
+	return m.withConn(ctx, func(conn *sql.Conn) error {
+		if err := m.dialect.lock(ctx, conn); err != nil {
+			return errors.Wrap(err, "lock")
+		}
+		defer func() {
+			if unlockErr := m.dialect.unlock(context.Background(), conn); unlockErr != nil {
+				infralog.Error("can't release migrations lock", zap.Error(unlockErr))
+			}
+		}()
+
+		if err := m.dialect.createTable(ctx, conn); err != nil {
+			return errors.Wrap(err, "create versions table")
+		}
+
+		applied, err := m.dialect.applied(ctx, conn)
+		if err != nil {
+			return errors.Wrap(err, "load applied versions")
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			query, err := fs.ReadFile(m.fsys, migration.file)
+			if err != nil {
+				return errors.Wrapf(err, "read \"%s\"", migration.file)
+			}
+
+			start := time.Now()
+			if err = m.dialect.apply(ctx, conn, migration, string(query)); err != nil {
+				return errors.Wrapf(err, "migration \"%s\"", migration.file)
+			}
+
+			infralog.Info("migration applied",
+				zap.Int64("version", migration.Version),
+				zap.String("name", migration.Name),
+				zap.Duration("duration", time.Since(start)))
+		}
+
+		return nil
+	})
+}
+
+// Status returns all migrations with their applied state. It changes nothing in the database, so it's suitable for dry runs.
+func (m *Migrator) Status(ctx context.Context) ([]*Migration, error) {
+	migrations, err := loadMigrations(m.fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.withConn(ctx, func(conn *sql.Conn) error {
+		exists, err := m.dialect.tableExists(ctx, conn)
+		if err != nil {
+			return errors.Wrap(err, "check versions table")
+		}
+		if !exists {
+			return nil
+		}
+
+		applied, err := m.dialect.applied(ctx, conn)
+		if err != nil {
+			return errors.Wrap(err, "load applied versions")
+		}
+
+		for _, migration := range migrations {
+			migration.AppliedAt, migration.Applied = applied[migration.Version]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return migrations, nil
+}
+
+// Pending returns migrations that are not applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]*Migration, error) {
+	migrations, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := migrations[:0]
+	for _, migration := range migrations {
+		if !migration.Applied {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// withConn runs fn on a dedicated connection, so session locks are held by the same connection
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "get connection")
+	}
+	defer func() { _ = conn.Close() }()
+
+	return fn(conn)
+}
+
+// loadMigrations returns migrations of the root directory sorted by version
+func loadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "read migrations dir")
+	}
+
+	migrations := make([]*Migration, 0, len(entries))
+	versions := make(map[int64]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		migration, err := parseMigrationName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if file, ok := versions[migration.Version]; ok {
+			return nil, errors.Errorf("duplicate version %d: \"%s\" and \"%s\"", migration.Version, file, entry.Name())
+		}
+		versions[migration.Version] = entry.Name()
+
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func parseMigrationName(file string) (*Migration, error) {
+	base := strings.TrimSuffix(file, ".sql")
+
+	versionStr, name, _ := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(versionStr, 10, 64)
+	if err != nil || version <= 0 {
+		return nil, errors.Errorf("invalid migration file name \"%s\", expected \"<version>_<name>.sql\"", file)
+	}
+
+	return &Migration{
+		Version: version,
+		Name:    name,
+		file:    file,
+	}, nil
+}
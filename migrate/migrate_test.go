@@ -0,0 +1,69 @@
+package inframigrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_loadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.sql":    {Data: []byte("CREATE INDEX ...")},
+		"0001_create_users.sql": {Data: []byte("CREATE TABLE ...")},
+		"10_seed.sql":           {Data: []byte("INSERT ...")},
+		"README.md":             {Data: []byte("docs")},
+	}
+
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int64
+	var names []string
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+		names = append(names, m.Name)
+	}
+
+	if !reflect.DeepEqual(versions, []int64{1, 2, 10}) {
+		t.Errorf("versions = %v", versions)
+	}
+	if !reflect.DeepEqual(names, []string{"create_users", "add_index", "seed"}) {
+		t.Errorf("names = %v", names)
+	}
+}
+
+func Test_loadMigrations_invalid(t *testing.T) {
+	tests := []fstest.MapFS{
+		{"create_users.sql": {}},
+		{"0001_a.sql": {}, "1_b.sql": {}},
+	}
+
+	for _, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("expected error for %v", fsys)
+		}
+	}
+}
+
+func Test_splitStatements(t *testing.T) {
+	script := `
+-- create table
+CREATE TABLE t (s String DEFAULT 'a;b') ENGINE = Memory;
+/* comment; */
+INSERT INTO t VALUES ('it\'s;');
+/* block comment
+   before the end; */
+-- trailing comment
+`
+
+	want := []string{
+		"-- create table\nCREATE TABLE t (s String DEFAULT 'a;b') ENGINE = Memory",
+		"/* comment; */\nINSERT INTO t VALUES ('it\\'s;')",
+	}
+
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitStatements() = %q, want %q", got, want)
+	}
+}
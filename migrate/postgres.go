@@ -0,0 +1,103 @@
+package inframigrate
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/postgres"
+)
+
+// NewPostgres creates a migrator of a named postgres connection.
+// Migrations are run under an advisory lock, so only one instance applies them at a time.
+// Each migration runs in a transaction together with recording its version.
+func NewPostgres(cont *infrapostgres.Container, connectionName string, fsys fs.FS, cfg *Config) (*Migrator, error) {
+	db := cont.Get(connectionName)
+	if db == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	return newMigrator(db, fsys, cfg, func(table string, _ string) dialect {
+		return &postgresDialect{
+			table:   pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+			lockKey: table,
+		}
+	})
+}
+
+type postgresDialect struct {
+	table   string
+	lockKey string
+}
+
+func (d *postgresDialect) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.table+` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+
+	return err
+}
+
+func (d *postgresDialect) tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, d.table).Scan(&exists)
+
+	return exists, err
+}
+
+func (d *postgresDialect) lock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, d.lockKey)
+	return err
+}
+
+func (d *postgresDialect) unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, d.lockKey)
+	return err
+}
+
+func (d *postgresDialect) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM `+d.table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (d *postgresDialect) apply(ctx context.Context, conn *sql.Conn, m *Migration, query string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// a query without arguments is sent by the simple protocol, so a file may contain several statements
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO `+d.table+` (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+		return errors.Wrap(err, "record version")
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,214 @@
+package mongo
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// cursorTTL is the default idle timeout of server cursors. Cursors not used for that time are forgotten
+const cursorTTL = 10 * time.Minute
+
+// collectionCommands are commands which take a collection name as the command value
+var collectionCommands = map[string]struct{}{
+	"insert":        {},
+	"find":          {},
+	"update":        {},
+	"delete":        {},
+	"findAndModify": {},
+	"aggregate":     {},
+	"count":         {},
+	"distinct":      {},
+	"mapReduce":     {},
+	"createIndexes": {},
+	"listIndexes":   {},
+	"dropIndexes":   {},
+	"create":        {},
+	"drop":          {},
+	"collMod":       {},
+	"collStats":     {},
+	"validate":      {},
+	"killCursors":   {},
+}
+
+// namespaceCommands are commands which take a full "db.collection" namespace as the command value
+var namespaceCommands = map[string]struct{}{
+	"renameCollection":  {},
+	"shardCollection":   {},
+	"reshardCollection": {},
+}
+
+// determineCollection returns a collection of a command. It doesn't know collections of cursors,
+// so getMore and killCursors should be resolved by cursorTracker.
+func determineCollection(startedEvent *event.CommandStartedEvent) string {
+	return commandCollection(startedEvent.Command)
+}
+
+func commandCollection(command bson.Raw) string {
+	elements, err := command.Elements()
+	if err != nil || len(elements) == 0 {
+		return ""
+	}
+
+	// the command name is the first key of a command
+	name := elements[0].Key()
+	value := elements[0].Value()
+
+	if _, ok := collectionCommands[name]; ok {
+		// db-level commands like {aggregate: 1} have no collection
+		collection, _ := value.StringValueOK()
+		return collection
+	}
+
+	if _, ok := namespaceCommands[name]; ok {
+		ns, _ := value.StringValueOK()
+		return namespaceCollection(ns)
+	}
+
+	switch name {
+	case "getMore":
+		collection, _ := command.Lookup("collection").StringValueOK()
+		return collection
+
+	case "explain":
+		if explained, ok := value.DocumentOK(); ok {
+			return commandCollection(explained)
+		}
+
+	case "bulkWrite":
+		return bulkWriteCollections(command)
+	}
+
+	return ""
+}
+
+// bulkWriteCollections returns comma-separated collections of a client bulk write
+func bulkWriteCollections(command bson.Raw) string {
+	nsInfo, ok := command.Lookup("nsInfo").ArrayOK()
+	if !ok {
+		return ""
+	}
+
+	values, _ := nsInfo.Values()
+	collections := make([]string, 0, len(values))
+	for _, value := range values {
+		doc, ok := value.DocumentOK()
+		if !ok {
+			continue
+		}
+
+		ns, _ := doc.Lookup("ns").StringValueOK()
+		if collection := namespaceCollection(ns); collection != "" {
+			collections = append(collections, collection)
+		}
+	}
+	sort.Strings(collections)
+
+	return strings.Join(collections, ",")
+}
+
+// namespaceCollection returns a collection of a "db.collection" namespace.
+// Namespaces of db-level commands like "db.$cmd.listCollections" have no collection.
+func namespaceCollection(ns string) string {
+	i := strings.IndexByte(ns, '.')
+	if i < 0 || strings.HasPrefix(ns[i+1:], "$cmd") {
+		return ""
+	}
+
+	return ns[i+1:]
+}
+
+// cursorTracker remembers collections of open cursors, so getMore and killCursors commands
+// are attributed to the collection of the command that opened the cursor
+type cursorTracker struct {
+	mu        sync.Mutex
+	cursors   map[int64]trackedCursor
+	lastPurge time.Time
+}
+
+type trackedCursor struct {
+	collection string
+	lastUsed   time.Time
+}
+
+func newCursorTracker() *cursorTracker {
+	return &cursorTracker{
+		cursors:   make(map[int64]trackedCursor),
+		lastPurge: time.Now(),
+	}
+}
+
+// collection returns a collection of a command
+func (t *cursorTracker) collection(startedEvent *event.CommandStartedEvent) string {
+	command := startedEvent.Command
+
+	var cursorID int64
+	switch startedEvent.CommandName {
+	case "getMore":
+		cursorID, _ = command.Lookup("getMore").AsInt64OK()
+	case "killCursors":
+		ids, _ := command.Lookup("cursors").ArrayOK()
+		values, _ := ids.Values()
+		if len(values) > 0 {
+			cursorID, _ = values[0].AsInt64OK()
+		}
+	}
+
+	if cursorID != 0 {
+		t.mu.Lock()
+		cursor, ok := t.cursors[cursorID]
+		t.mu.Unlock()
+
+		if ok {
+			return cursor.collection
+		}
+	}
+
+	return determineCollection(startedEvent)
+}
+
+// track remembers a cursor opened by a succeeded command and forgets exhausted and killed ones
+func (t *cursorTracker) track(startedEvent *event.CommandStartedEvent, succeededEvent *event.CommandSucceededEvent) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if startedEvent.CommandName == "killCursors" {
+		ids, _ := startedEvent.Command.Lookup("cursors").ArrayOK()
+		values, _ := ids.Values()
+		for _, value := range values {
+			if id, ok := value.AsInt64OK(); ok {
+				delete(t.cursors, id)
+			}
+		}
+
+		return
+	}
+
+	if startedEvent.CommandName == "getMore" {
+		id, _ := startedEvent.Command.Lookup("getMore").AsInt64OK()
+		delete(t.cursors, id)
+	}
+
+	// find, aggregate, listIndexes, getMore and others return {cursor: {id, ns}}.
+	// A zero id means the cursor is exhausted.
+	id, _ := succeededEvent.Reply.Lookup("cursor", "id").AsInt64OK()
+	if id != 0 {
+		ns, _ := succeededEvent.Reply.Lookup("cursor", "ns").StringValueOK()
+		t.cursors[id] = trackedCursor{collection: namespaceCollection(ns), lastUsed: now}
+	}
+
+	if now.Sub(t.lastPurge) > cursorTTL {
+		for id, cursor := range t.cursors {
+			if now.Sub(cursor.lastUsed) > cursorTTL {
+				delete(t.cursors, id)
+			}
+		}
+		t.lastPurge = now
+	}
+}
@@ -0,0 +1,104 @@
+package mongo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// doc builds an ordered document of key-value pairs
+func doc(pairs ...interface{}) bson.D {
+	d := make(bson.D, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		d = append(d, bson.E{Key: pairs[i].(string), Value: pairs[i+1]})
+	}
+
+	return d
+}
+
+func startedEvent(t *testing.T, command bson.D) *event.CommandStartedEvent {
+	t.Helper()
+
+	raw, err := bson.Marshal(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &event.CommandStartedEvent{
+		Command:     raw,
+		CommandName: command[0].Key,
+	}
+}
+
+func succeededEvent(t *testing.T, reply bson.D) *event.CommandSucceededEvent {
+	t.Helper()
+
+	raw, err := bson.Marshal(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &event.CommandSucceededEvent{Reply: raw}
+}
+
+func Test_determineCollection(t *testing.T) {
+	tests := []struct {
+		command bson.D
+		want    string
+	}{
+		{doc("find", "users", "filter", doc()), "users"},
+		{doc("update", "users", "updates", bson.A{}), "users"},
+		{doc("aggregate", "events", "pipeline", bson.A{}), "events"},
+		{doc("aggregate", int32(1), "pipeline", bson.A{}), ""},
+		{doc("count", "users"), "users"},
+		{doc("distinct", "users", "key", "name"), "users"},
+		{doc("createIndexes", "users", "indexes", bson.A{}), "users"},
+		{doc("listIndexes", "users"), "users"},
+		{doc("drop", "users"), "users"},
+		{doc("getMore", int64(42), "collection", "users"), "users"},
+		{doc("renameCollection", "app.users", "to", "app.people"), "users"},
+		{doc("explain", doc("find", "users")), "users"},
+		{doc("bulkWrite", int32(1), "nsInfo", bson.A{doc("ns", "app.users"), doc("ns", "app.events")}), "events,users"},
+		{doc("listCollections", int32(1)), ""},
+		{doc("ping", int32(1)), ""},
+	}
+
+	for _, test := range tests {
+		if got := determineCollection(startedEvent(t, test.command)); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.command[0].Key, got, test.want)
+		}
+	}
+}
+
+func Test_cursorTracker(t *testing.T) {
+	tracker := newCursorTracker()
+
+	find := startedEvent(t, doc("find", "users"))
+	tracker.track(find, succeededEvent(t, doc("cursor", doc("id", int64(42), "ns", "app.users"))))
+
+	aggregate := startedEvent(t, doc("aggregate", int32(1)))
+	tracker.track(aggregate, succeededEvent(t, doc("cursor", doc("id", int64(43), "ns", "app.$cmd.aggregate"))))
+
+	// getMore without a collection field is resolved by the cursor
+	getMore := startedEvent(t, doc("getMore", int64(42)))
+	if got := tracker.collection(getMore); got != "users" {
+		t.Errorf("getMore: got %q, want \"users\"", got)
+	}
+
+	// the cursor is exhausted
+	tracker.track(getMore, succeededEvent(t, doc("cursor", doc("id", int64(0), "ns", "app.users"))))
+	if _, ok := tracker.cursors[42]; ok {
+		t.Error("exhausted cursor is tracked")
+	}
+
+	killCursors := startedEvent(t, doc("killCursors", "events", "cursors", bson.A{int64(43)}))
+	if got := tracker.collection(killCursors); got != "" {
+		t.Errorf("killCursors: got %q, want collection of the db-level cursor", got)
+	}
+
+	tracker.track(killCursors, succeededEvent(t, doc("ok", 1)))
+	if len(tracker.cursors) != 0 {
+		t.Errorf("%d cursors are tracked after killCursors", len(tracker.cursors))
+	}
+}
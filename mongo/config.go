@@ -1,11 +1,34 @@
 package mongo
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/v2/tag"
 )
 
+// minMaxStaleness is the minimum max staleness accepted by servers
+const minMaxStaleness = 90 * time.Second
+
+var readConcernLevels = map[string]struct{}{
+	"local":        {},
+	"majority":     {},
+	"linearizable": {},
+	"available":    {},
+	"snapshot":     {},
+}
+
+var compressors = map[string]struct{}{
+	"snappy": {},
+	"zlib":   {},
+	"zstd":   {},
+}
+
 type ConnectionsConfig map[string]*ConnectionConfig
 
 type ConnectionConfig struct {
@@ -15,6 +38,60 @@ type ConnectionConfig struct {
 
 	// Query log config
 	QueryLog *QueryLoggingConfig `mapstructure:"query_log"`
+
+	// Connection checkouts that waited longer than that time are logged. Default is 500ms
+	SlowCheckoutThreshold time.Duration `mapstructure:"slow_checkout_threshold"`
+
+	// Default database available via GetDatabase. The URI database is used if not set
+	Database string `mapstructure:"database"`
+
+	// Options below override the URI ones if set
+
+	// Read preference. Optional
+	ReadPreference *ReadPreferenceConfig `mapstructure:"read_preference"`
+
+	// Read concern level: "local", "majority", "linearizable", "available" or "snapshot". Optional
+	ReadConcern string `mapstructure:"read_concern"`
+
+	// Write concern. Optional
+	WriteConcern *WriteConcernConfig `mapstructure:"write_concern"`
+
+	// Minimum and maximum number of connections in a pool of each server
+	MinPoolSize uint64 `mapstructure:"min_pool_size"`
+	MaxPoolSize uint64 `mapstructure:"max_pool_size"`
+
+	// Timeout of establishing a connection
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+
+	// Timeout of selecting a server for an operation
+	ServerSelectionTimeout time.Duration `mapstructure:"server_selection_timeout"`
+
+	// Client-wide timeout of every operation including server selection and retries. Disabled by default.
+	// It's not a socket timeout: it limits the whole operation, so long aggregations and cursor iteration
+	// are interrupted too. Prefer context deadlines for particular operations
+	OperationTimeout time.Duration `mapstructure:"operation_timeout"`
+
+	// Compressors in order of preference: "snappy", "zlib" or "zstd". Optional
+	Compressors []string `mapstructure:"compressors"`
+}
+
+type ReadPreferenceConfig struct {
+	// Read preference mode
+	Mode ConnectionReadPreference `mapstructure:"mode"`
+
+	// Secondaries lagging behind the primary more than that are not read from. Must be at least 90s. Optional
+	MaxStaleness time.Duration `mapstructure:"max_staleness"`
+
+	// Tag sets of servers in order of preference, e.g. [{dc: east}, {}]. Optional
+	TagSets []map[string]string `mapstructure:"tag_sets"`
+}
+
+type WriteConcernConfig struct {
+	// Number of acknowledging nodes, "majority" or a custom write concern name
+	W string `mapstructure:"w"`
+
+	// Whether to wait for the on-disk journal. Server default is used if not set
+	Journal *bool `mapstructure:"journal"`
 }
 
 type QueryLoggingConfig struct {
@@ -55,9 +132,116 @@ func (c *ConnectionConfig) Validate() error {
 		return errors.New("uri is empty")
 	}
 
+	if c.SlowCheckoutThreshold < 0 {
+		return errors.New("slow_checkout_threshold must not be negative")
+	}
+
+	if c.ReadPreference != nil {
+		if _, err := c.ReadPreference.readPref(); err != nil {
+			return errors.Wrap(err, "read_preference")
+		}
+	}
+
+	if _, ok := readConcernLevels[c.ReadConcern]; !ok && c.ReadConcern != "" {
+		return errors.Errorf("unknown read_concern \"%s\"", c.ReadConcern)
+	}
+
+	if c.WriteConcern != nil && c.WriteConcern.W == "" && c.WriteConcern.Journal == nil {
+		return errors.New("write_concern: w or journal must be set")
+	}
+
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		return errors.New("min_pool_size must not be greater than max_pool_size")
+	}
+
+	if c.ConnectTimeout < 0 || c.ServerSelectionTimeout < 0 || c.OperationTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+
+	for _, compressor := range c.Compressors {
+		if _, ok := compressors[compressor]; !ok {
+			return errors.Errorf("unknown compressor \"%s\"", compressor)
+		}
+	}
+
+	return nil
+}
+
+// apply overrides client options with the config
+func (c *ConnectionConfig) apply(opts *options.ClientOptions) error {
+	if c.ReadPreference != nil {
+		rp, err := c.ReadPreference.readPref()
+		if err != nil {
+			return errors.Wrap(err, "read_preference")
+		}
+		opts.SetReadPreference(rp)
+	}
+
+	if c.ReadConcern != "" {
+		opts.SetReadConcern(&readconcern.ReadConcern{Level: c.ReadConcern})
+	}
+
+	if c.WriteConcern != nil {
+		opts.SetWriteConcern(c.WriteConcern.writeConcern())
+	}
+
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+	}
+	if c.OperationTimeout > 0 {
+		opts.SetTimeout(c.OperationTimeout)
+	}
+
+	if len(c.Compressors) > 0 {
+		opts.SetCompressors(c.Compressors)
+	}
+
 	return nil
 }
 
+func (c *ReadPreferenceConfig) readPref() (*readpref.ReadPref, error) {
+	base := ReadPreferenceFromString(c.Mode)
+	if base == nil {
+		return nil, errors.Errorf("unknown mode \"%s\"", c.Mode)
+	}
+
+	if c.MaxStaleness > 0 && c.MaxStaleness < minMaxStaleness {
+		return nil, errors.Errorf("max_staleness must be at least %s", minMaxStaleness)
+	}
+
+	var opts []readpref.Option
+	if c.MaxStaleness > 0 {
+		opts = append(opts, readpref.WithMaxStaleness(c.MaxStaleness))
+	}
+	if len(c.TagSets) > 0 {
+		opts = append(opts, readpref.WithTagSets(tag.NewTagSetsFromMaps(c.TagSets)...))
+	}
+
+	return readpref.New(base.Mode(), opts...)
+}
+
+func (c *WriteConcernConfig) writeConcern() *writeconcern.WriteConcern {
+	wc := &writeconcern.WriteConcern{Journal: c.Journal}
+
+	if w, err := strconv.Atoi(c.W); err == nil {
+		wc.W = w
+	} else if c.W != "" {
+		wc.W = c.W
+	}
+
+	return wc
+}
+
 func (c *QueryLoggingConfig) Validate() error {
 	if c == nil {
 		return errors.New("empty config")
@@ -0,0 +1,64 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+func Test_ConnectionConfig_apply(t *testing.T) {
+	journal := true
+	cfg := &ConnectionConfig{
+		URI:      "mongodb://localhost:27017/app?maxPoolSize=10",
+		QueryLog: &QueryLoggingConfig{},
+		ReadPreference: &ReadPreferenceConfig{
+			Mode:         ReadPreferenceSecondaryPreferred,
+			MaxStaleness: 2 * time.Minute,
+			TagSets:      []map[string]string{{"dc": "east"}, {}},
+		},
+		ReadConcern:      "majority",
+		WriteConcern:     &WriteConcernConfig{W: "2", Journal: &journal},
+		MaxPoolSize:      50,
+		Compressors:      []string{"zstd", "snappy"},
+		OperationTimeout: 5 * time.Second,
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.Client().ApplyURI(cfg.URI)
+	if err := cfg.apply(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode || len(opts.ReadPreference.TagSets()) != 2 {
+		t.Errorf("invalid read preference: %s", opts.ReadPreference)
+	}
+	if staleness, _ := opts.ReadPreference.MaxStaleness(); staleness != 2*time.Minute {
+		t.Errorf("invalid max staleness: %s", staleness)
+	}
+
+	if opts.ReadConcern.Level != "majority" {
+		t.Errorf("invalid read concern: %s", opts.ReadConcern.Level)
+	}
+
+	if opts.WriteConcern.W != 2 || opts.WriteConcern.Journal == nil || !*opts.WriteConcern.Journal {
+		t.Errorf("invalid write concern: %+v", opts.WriteConcern)
+	}
+
+	if opts.MaxPoolSize == nil || *opts.MaxPoolSize != 50 {
+		t.Error("max pool size of the URI is not overridden")
+	}
+
+	if len(opts.Compressors) != 2 || opts.Timeout == nil || *opts.Timeout != 5*time.Second {
+		t.Errorf("invalid compressors and timeout: %v %v", opts.Compressors, opts.Timeout)
+	}
+
+	cfg.ReadPreference = &ReadPreferenceConfig{Mode: ReadPreferencePrimary, TagSets: []map[string]string{{"dc": "east"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("tag sets of primary read preference are accepted")
+	}
+}
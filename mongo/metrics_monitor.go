@@ -45,18 +45,21 @@ func initMetrics() {
 func initMetricsMonitor(b *monitorBuilder, name string) {
 	initMetrics()
 
+	cursors := newCursorTracker()
+
 	b.Add(
 		func(ctx context.Context, startedEvent *event.CommandStartedEvent) {
-			collection := determineCollection(startedEvent)
+			collection := cursors.collection(startedEvent)
 			metrics.StartedQueryCounter.WithLabelValues(name, startedEvent.DatabaseName, collection, startedEvent.CommandName).Inc()
 		},
 		func(ctx context.Context, startedEvent *event.CommandStartedEvent, succeededEvent *event.CommandSucceededEvent) {
-			collection := determineCollection(startedEvent)
+			collection := cursors.collection(startedEvent)
+			cursors.track(startedEvent, succeededEvent)
 			metrics.FinishedQueryCounter.WithLabelValues(name, startedEvent.DatabaseName, collection, succeededEvent.CommandName, "success").Inc()
 			metrics.QueryDurationHistogram.WithLabelValues(name, startedEvent.DatabaseName, collection, succeededEvent.CommandName, "success").Observe(succeededEvent.Duration.Seconds())
 		},
 		func(ctx context.Context, startedEvent *event.CommandStartedEvent, failedEvent *event.CommandFailedEvent) {
-			collection := determineCollection(startedEvent)
+			collection := cursors.collection(startedEvent)
 			metrics.FinishedQueryCounter.WithLabelValues(name, startedEvent.DatabaseName, collection, failedEvent.CommandName, "error").Inc()
 			metrics.QueryDurationHistogram.WithLabelValues(name, startedEvent.DatabaseName, collection, failedEvent.CommandName, "error").Observe(failedEvent.Duration.Seconds())
 		},
@@ -3,6 +3,8 @@ package mongo
 import (
 	"context"
 	"net"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,25 +27,40 @@ const (
 // Container is a simple container for holding named mongo connections.
 // It's a helper for sharing same connection between several components.
 type Container struct {
-	mu   *sync.RWMutex
-	cfg  map[string]ConnectionConfig
-	pool map[string]*mongo.Client
+	mu        *sync.RWMutex
+	cfg       map[string]ConnectionConfig
+	pool      map[string]*mongo.Client
+	databases map[string]*mongo.Database
 }
 
 func NewContainer() *Container {
 	return &Container{
-		mu:   &sync.RWMutex{},
-		cfg:  make(map[string]ConnectionConfig),
-		pool: make(map[string]*mongo.Client),
+		mu:        &sync.RWMutex{},
+		cfg:       make(map[string]ConnectionConfig),
+		pool:      make(map[string]*mongo.Client),
+		databases: make(map[string]*mongo.Database),
 	}
 }
 
 // Connect creates a new named mongo connection.
+// Options set in the config override the URI ones.
 func (cont *Container) Connect(appName string, name string, cfg *ConnectionConfig) error {
 	opts := options.Client()
 	opts.ApplyURI(cfg.URI)
 	opts.SetAppName(appName)
 
+	if err := cfg.apply(opts); err != nil {
+		return err
+	}
+
+	database := cfg.Database
+	if database == "" {
+		var err error
+		if database, err = uriDatabase(cfg.URI); err != nil {
+			return errors.Wrap(err, "uriDatabase")
+		}
+	}
+
 	addresses, err := prepareAddresses(opts.Hosts)
 	if err != nil {
 		return errors.Wrap(err, "prepareAddresses")
@@ -64,6 +81,8 @@ func (cont *Container) Connect(appName string, name string, cfg *ConnectionConfi
 	initLoggingMonitor(mb, cfg.QueryLog)
 
 	opts.SetMonitor(mb.Build())
+	opts.SetPoolMonitor(newPoolMonitor(appName, name, cfg.SlowCheckoutThreshold))
+	opts.SetServerMonitor(newServerMonitor(appName, name))
 
 	// connect and ping
 	client, err := mongo.Connect(opts)
@@ -82,6 +101,12 @@ func (cont *Container) Connect(appName string, name string, cfg *ConnectionConfi
 	cont.pool[name] = client
 	cont.cfg[name] = *cfg
 
+	if database != "" {
+		cont.databases[name] = client.Database(database)
+	} else {
+		delete(cont.databases, name)
+	}
+
 	return nil
 }
 
@@ -93,6 +118,15 @@ func (cont *Container) Get(name string) *mongo.Client {
 	return cont.pool[name]
 }
 
+// GetDatabase gets a default database of a connection from the container.
+// Returns nil if the connection has no default database
+func (cont *Container) GetDatabase(name string) *mongo.Database {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	return cont.databases[name]
+}
+
 func ReadPreferenceFromString(src ConnectionReadPreference) *readpref.ReadPref {
 	switch src {
 	case ReadPreferencePrimary:
@@ -110,6 +144,23 @@ func ReadPreferenceFromString(src ConnectionReadPreference) *readpref.ReadPref {
 	}
 }
 
+// uriDatabase returns the database of a "mongodb://" or "mongodb+srv://" URI path.
+// Hosts are skipped without parsing, since net/url doesn't support several hosts
+func uriDatabase(uri string) (string, error) {
+	_, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return "", errors.New("scheme is missing")
+	}
+
+	rest, _, _ = strings.Cut(rest, "?")
+	_, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", nil
+	}
+
+	return url.PathUnescape(path)
+}
+
 // prepareAddresses
 // We use DNS to group several mongos's together, but the mongo driver
 // starts to think that all those mongos's are one physical instance with different addresses.
@@ -2,7 +2,6 @@ package mongo
 
 import (
 	"context"
-	"strconv"
 	"sync"
 
 	"go.mongodb.org/mongo-driver/v2/event"
@@ -64,28 +63,3 @@ func (b *monitorBuilder) Build() *event.CommandMonitor {
 		},
 	}
 }
-
-var operationsMap = map[string]interface{}{
-	"insert":        nil,
-	"find":          nil,
-	"update":        nil,
-	"delete":        nil,
-	"findAndModify": nil,
-}
-
-func determineCollection(startedEvent *event.CommandStartedEvent) string {
-	elements, _ := startedEvent.Command.Elements()
-	for i := range elements {
-		_, ok := operationsMap[elements[i].Key()]
-		if ok {
-			quoted := elements[i].Value().String()
-			unquoted, err := strconv.Unquote(quoted)
-			if err != nil {
-				return quoted
-			}
-
-			return unquoted
-		}
-	}
-	return ""
-}
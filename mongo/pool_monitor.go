@@ -0,0 +1,198 @@
+package mongo
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.uber.org/zap"
+)
+
+const defaultSlowCheckoutThreshold = 500 * time.Millisecond
+
+var poolMetrics struct {
+	ConnectionsCreatedCounter *prometheus.CounterVec
+	ConnectionsClosedCounter  *prometheus.CounterVec
+	Connections               *prometheus.GaugeVec
+	CheckedOutConnections     *prometheus.GaugeVec
+	CheckoutDuration          *prometheus.HistogramVec
+	PoolClearedCounter        *prometheus.CounterVec
+	HeartbeatDuration         *prometheus.HistogramVec
+	TopologyChangedCounter    *prometheus.CounterVec
+}
+var poolMetricsOnce sync.Once
+
+func initPoolMetrics() {
+	poolMetricsOnce.Do(func() {
+		poolMetrics.ConnectionsCreatedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mongo_pool_connections_created_counter",
+			Help: "The total number of created connections",
+		}, []string{"app", "connection", "address"})
+
+		poolMetrics.ConnectionsClosedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mongo_pool_connections_closed_counter",
+			Help: "The total number of closed connections by reason",
+		}, []string{"app", "connection", "address", "reason"})
+
+		poolMetrics.Connections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mongo_pool_connections",
+			Help: "The number of open connections",
+		}, []string{"app", "connection", "address"})
+
+		poolMetrics.CheckedOutConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mongo_pool_checked_out_connections",
+			Help: "The number of connections currently checked out of a pool",
+		}, []string{"app", "connection", "address"})
+
+		poolMetrics.CheckoutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mongo_pool_checkout_duration",
+			Help:    "The time spent waiting for a connection checkout",
+			Buckets: []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"app", "connection", "status"})
+
+		poolMetrics.PoolClearedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mongo_pool_cleared_counter",
+			Help: "The total number of pool clears caused by server errors",
+		}, []string{"app", "connection", "address"})
+
+		poolMetrics.HeartbeatDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mongo_server_heartbeat_duration",
+			Help:    "The server heartbeat latency. Awaited heartbeats of the streaming protocol are not observed",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"app", "connection", "address", "status"})
+
+		poolMetrics.TopologyChangedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mongo_topology_changed_counter",
+			Help: "The total number of topology changes by the new topology kind",
+		}, []string{"app", "connection", "kind"})
+
+		prometheus.MustRegister(
+			poolMetrics.ConnectionsCreatedCounter,
+			poolMetrics.ConnectionsClosedCounter,
+			poolMetrics.Connections,
+			poolMetrics.CheckedOutConnections,
+			poolMetrics.CheckoutDuration,
+			poolMetrics.PoolClearedCounter,
+			poolMetrics.HeartbeatDuration,
+			poolMetrics.TopologyChangedCounter,
+		)
+	})
+}
+
+// newPoolMonitor returns a monitor exporting metrics of connection pools.
+// Slow and failed checkouts and pool clears are logged.
+func newPoolMonitor(app string, name string, slowCheckoutThreshold time.Duration) *event.PoolMonitor {
+	initPoolMetrics()
+
+	if slowCheckoutThreshold <= 0 {
+		slowCheckoutThreshold = defaultSlowCheckoutThreshold
+	}
+
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			fields := func(extra ...zap.Field) []zap.Field {
+				return append([]zap.Field{
+					zap.String("app", app),
+					zap.String("connection", name),
+					zap.String("address", e.Address),
+				}, extra...)
+			}
+
+			switch e.Type {
+			case event.ConnectionCreated:
+				poolMetrics.ConnectionsCreatedCounter.WithLabelValues(app, name, e.Address).Inc()
+				poolMetrics.Connections.WithLabelValues(app, name, e.Address).Inc()
+
+			case event.ConnectionClosed:
+				poolMetrics.ConnectionsClosedCounter.WithLabelValues(app, name, e.Address, e.Reason).Inc()
+				poolMetrics.Connections.WithLabelValues(app, name, e.Address).Dec()
+
+			case event.ConnectionCheckedOut:
+				poolMetrics.CheckedOutConnections.WithLabelValues(app, name, e.Address).Inc()
+				poolMetrics.CheckoutDuration.WithLabelValues(app, name, "success").Observe(e.Duration.Seconds())
+
+				if e.Duration > slowCheckoutThreshold {
+					infralog.Warn("slow mongo connection checkout", fields(zap.Duration("duration", e.Duration))...)
+				}
+
+			case event.ConnectionCheckedIn:
+				poolMetrics.CheckedOutConnections.WithLabelValues(app, name, e.Address).Dec()
+
+			case event.ConnectionCheckOutFailed:
+				poolMetrics.CheckoutDuration.WithLabelValues(app, name, "error").Observe(e.Duration.Seconds())
+
+				infralog.Error("mongo connection checkout failed", fields(
+					zap.Duration("duration", e.Duration),
+					zap.String("reason", e.Reason),
+					zap.Error(e.Error),
+				)...)
+
+			case event.ConnectionPoolCleared:
+				poolMetrics.PoolClearedCounter.WithLabelValues(app, name, e.Address).Inc()
+
+				infralog.Warn("mongo connection pool cleared", fields(
+					zap.Bool("interrupt_in_use_connections", e.Interruption),
+					zap.Error(e.Error),
+				)...)
+			}
+		},
+	}
+}
+
+// newServerMonitor returns a monitor exporting heartbeat latency and topology changes.
+// Changes of server kinds, like a primary step down, and failed heartbeats are logged.
+func newServerMonitor(app string, name string) *event.ServerMonitor {
+	initPoolMetrics()
+
+	return &event.ServerMonitor{
+		ServerHeartbeatSucceeded: func(e *event.ServerHeartbeatSucceededEvent) {
+			if e.Awaited {
+				return
+			}
+
+			address := heartbeatAddress(e.ConnectionID)
+			poolMetrics.HeartbeatDuration.WithLabelValues(app, name, address, "success").Observe(e.Duration.Seconds())
+		},
+		ServerHeartbeatFailed: func(e *event.ServerHeartbeatFailedEvent) {
+			address := heartbeatAddress(e.ConnectionID)
+			if !e.Awaited {
+				poolMetrics.HeartbeatDuration.WithLabelValues(app, name, address, "error").Observe(e.Duration.Seconds())
+			}
+
+			infralog.Warn("mongo server heartbeat failed",
+				zap.String("app", app),
+				zap.String("connection", name),
+				zap.String("address", address),
+				zap.Error(e.Failure),
+			)
+		},
+		ServerDescriptionChanged: func(e *event.ServerDescriptionChangedEvent) {
+			if e.PreviousDescription.Kind == e.NewDescription.Kind {
+				return
+			}
+
+			infralog.Info("mongo server kind changed",
+				zap.String("app", app),
+				zap.String("connection", name),
+				zap.String("address", e.Address.String()),
+				zap.String("previous_kind", e.PreviousDescription.Kind),
+				zap.String("kind", e.NewDescription.Kind),
+			)
+		},
+		TopologyDescriptionChanged: func(e *event.TopologyDescriptionChangedEvent) {
+			poolMetrics.TopologyChangedCounter.WithLabelValues(app, name, e.NewDescription.Kind).Inc()
+		},
+	}
+}
+
+// heartbeatAddress returns a server address of a heartbeat connection id like "host:port[-1]"
+func heartbeatAddress(connectionID string) string {
+	if i := strings.LastIndex(connectionID, "[-"); i >= 0 {
+		return connectionID[:i]
+	}
+
+	return connectionID
+}
@@ -0,0 +1,135 @@
+package mongo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pushwoosh/infra/log"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_heartbeatAddress(t *testing.T) {
+	tests := []struct {
+		connectionID string
+		want         string
+	}{
+		{"localhost:27017[-1]", "localhost:27017"},
+		{"mongo-0.mongo:27017[-12]", "mongo-0.mongo:27017"},
+		{"[::1]:27017[-3]", "[::1]:27017"},
+		{"localhost:27017", "localhost:27017"},
+	}
+
+	for _, tt := range tests {
+		if got := heartbeatAddress(tt.connectionID); got != tt.want {
+			t.Errorf("heartbeatAddress(%s) = %s, want %s", tt.connectionID, got, tt.want)
+		}
+	}
+}
+
+// poolWarnings collects warnings of the pool monitor
+var poolWarnings struct {
+	once     sync.Once
+	mu       sync.Mutex
+	messages []string
+}
+
+func capturePoolWarnings() {
+	poolWarnings.once.Do(func() {
+		infralog.RegisterLogHandler(func(entry *infralog.LogEntry) {
+			if entry.Level != zapcore.WarnLevel {
+				return
+			}
+
+			poolWarnings.mu.Lock()
+			poolWarnings.messages = append(poolWarnings.messages, entry.Message)
+			poolWarnings.mu.Unlock()
+		})
+	})
+
+	poolWarnings.mu.Lock()
+	poolWarnings.messages = nil
+	poolWarnings.mu.Unlock()
+}
+
+func slowCheckoutWarnings() int {
+	poolWarnings.mu.Lock()
+	defer poolWarnings.mu.Unlock()
+
+	n := 0
+	for _, message := range poolWarnings.messages {
+		if message == "slow mongo connection checkout" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func Test_newPoolMonitor(t *testing.T) {
+	capturePoolWarnings()
+
+	const address = "localhost:27017"
+	monitor := newPoolMonitor("app", "pool_test", 100*time.Millisecond)
+
+	// metrics are global, so series of previous runs are removed
+	connection := prometheus.Labels{"connection": "pool_test"}
+	poolMetrics.Connections.DeletePartialMatch(connection)
+	poolMetrics.ConnectionsCreatedCounter.DeletePartialMatch(connection)
+	poolMetrics.ConnectionsClosedCounter.DeletePartialMatch(connection)
+	poolMetrics.CheckedOutConnections.DeletePartialMatch(connection)
+	poolMetrics.PoolClearedCounter.DeletePartialMatch(connection)
+
+	for _, e := range []*event.PoolEvent{
+		{Type: event.ConnectionCreated, Address: address},
+		{Type: event.ConnectionCreated, Address: address},
+		{Type: event.ConnectionCreated, Address: address},
+		{Type: event.ConnectionClosed, Address: address, Reason: event.ReasonIdle},
+		{Type: event.ConnectionCheckedOut, Address: address, Duration: time.Millisecond},
+		{Type: event.ConnectionCheckedOut, Address: address, Duration: time.Second},
+		{Type: event.ConnectionCheckedIn, Address: address},
+		{Type: event.ConnectionPoolCleared, Address: address},
+	} {
+		monitor.Event(e)
+	}
+
+	if v := testutil.ToFloat64(poolMetrics.Connections.WithLabelValues("app", "pool_test", address)); v != 2 {
+		t.Errorf("open connections = %v, want 2", v)
+	}
+
+	if v := testutil.ToFloat64(poolMetrics.ConnectionsCreatedCounter.WithLabelValues("app", "pool_test", address)); v != 3 {
+		t.Errorf("created connections = %v, want 3", v)
+	}
+
+	if v := testutil.ToFloat64(poolMetrics.ConnectionsClosedCounter.WithLabelValues("app", "pool_test", address, event.ReasonIdle)); v != 1 {
+		t.Errorf("closed connections = %v, want 1", v)
+	}
+
+	if v := testutil.ToFloat64(poolMetrics.CheckedOutConnections.WithLabelValues("app", "pool_test", address)); v != 1 {
+		t.Errorf("checked out connections = %v, want 1", v)
+	}
+
+	if v := testutil.ToFloat64(poolMetrics.PoolClearedCounter.WithLabelValues("app", "pool_test", address)); v != 1 {
+		t.Errorf("pool clears = %v, want 1", v)
+	}
+
+	// only the checkout longer than the threshold is slow
+	if n := slowCheckoutWarnings(); n != 1 {
+		t.Errorf("slow checkout warnings = %d, want 1", n)
+	}
+}
+
+func Test_newPoolMonitor_defaultThreshold(t *testing.T) {
+	capturePoolWarnings()
+
+	monitor := newPoolMonitor("app", "pool_default_test", 0)
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCheckedOut, Duration: defaultSlowCheckoutThreshold / 2})
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCheckedOut, Duration: 2 * defaultSlowCheckoutThreshold})
+
+	if n := slowCheckoutWarnings(); n != 1 {
+		t.Errorf("slow checkout warnings = %d, want 1", n)
+	}
+}
@@ -1,14 +1,72 @@
 package infranats
 
 import (
+	"crypto/tls"
+	"time"
+
+	"github.com/nats-io/nats.go"
 	"github.com/pkg/errors"
 )
 
 type ConnectionsConfig map[string]*ConnectionConfig
 
 type ConnectionConfig struct {
-	// NATS Address
+	// NATS Address. Comma-separated list of "nats://host:port" is allowed
 	Address string `mapstructure:"address"`
+
+	// Connection name shown in server monitoring. Optional
+	Name string `mapstructure:"name"`
+
+	// Path to a credentials file (JWT and nkey seed). Optional
+	CredentialsFile string `mapstructure:"credentials_file"`
+
+	// Path to an nkey seed file. Optional
+	NKeySeedFile string `mapstructure:"nkey_seed_file"`
+
+	// User/password authentication. Optional
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	// Token authentication. Optional
+	Token string `mapstructure:"token"`
+
+	// TLS config. Optional
+	TLS *TLSConfig `mapstructure:"tls"`
+
+	// Maximum number of reconnect attempts. -1 means infinite. Client default (60) is used if not set
+	MaxReconnects *int `mapstructure:"max_reconnects"`
+
+	// Wait time between reconnect attempts to the same server. Client default (2s) is used if not set
+	ReconnectWait time.Duration `mapstructure:"reconnect_wait"`
+
+	// Random jitter added to ReconnectWait. Client defaults (100ms, 1s for TLS) are used if not set
+	ReconnectJitter    time.Duration `mapstructure:"reconnect_jitter"`
+	ReconnectJitterTLS time.Duration `mapstructure:"reconnect_jitter_tls"`
+
+	// Interval of client pings. Client default (2m) is used if not set
+	PingInterval time.Duration `mapstructure:"ping_interval"`
+
+	// Size of the buffer for messages published while reconnecting, in bytes.
+	// -1 disables buffering. Client default (8MB) is used if not set
+	ReconnectBufSize int `mapstructure:"reconnect_buf_size"`
+
+	// JetStream streams and consumers declared on connect. Optional
+	JetStream *JetStreamConfig `mapstructure:"jetstream"`
+}
+
+type TLSConfig struct {
+	// Path to CA certificate file. System CAs are used if not set
+	CAFile string `mapstructure:"ca_file"`
+
+	// Paths to client certificate and key files. Optional
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+
+	// Server name used for certificate verification. Optional
+	ServerName string `mapstructure:"server_name"`
+
+	// Disables server certificate verification. Use for testing only
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
 }
 
 func (c *ConnectionsConfig) Validate() error {
@@ -34,5 +92,113 @@ func (c *ConnectionConfig) Validate() error {
 		return errors.New("address is mandatory")
 	}
 
+	authMethods := 0
+	for _, isSet := range []bool{c.CredentialsFile != "", c.NKeySeedFile != "", c.Username != "", c.Token != ""} {
+		if isSet {
+			authMethods++
+		}
+	}
+
+	if authMethods > 1 {
+		return errors.New("only one of credentials_file, nkey_seed_file, username or token may be set")
+	}
+
+	if c.Password != "" && c.Username == "" {
+		return errors.New("username is mandatory if password is set")
+	}
+
+	if err := c.TLS.Validate(); err != nil {
+		return errors.Wrap(err, "tls")
+	}
+
+	if c.ReconnectWait < 0 || c.ReconnectJitter < 0 || c.ReconnectJitterTLS < 0 || c.PingInterval < 0 {
+		return errors.New("reconnect and ping intervals must not be negative")
+	}
+
+	if err := c.JetStream.Validate(); err != nil {
+		return errors.Wrap(err, "jetstream")
+	}
+
+	return nil
+}
+
+func (c *TLSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("both cert_file and key_file must be set")
+	}
+
 	return nil
 }
+
+// options returns NATS connection options built from the config
+func (c *ConnectionConfig) options() ([]nats.Option, error) {
+	var opts []nats.Option
+
+	if c.Name != "" {
+		opts = append(opts, nats.Name(c.Name))
+	}
+
+	switch {
+	case c.CredentialsFile != "":
+		opts = append(opts, nats.UserCredentials(c.CredentialsFile))
+	case c.NKeySeedFile != "":
+		opt, err := nats.NkeyOptionFromSeed(c.NKeySeedFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "nkey_seed_file")
+		}
+		opts = append(opts, opt)
+	case c.Username != "":
+		opts = append(opts, nats.UserInfo(c.Username, c.Password))
+	case c.Token != "":
+		opts = append(opts, nats.Token(c.Token))
+	}
+
+	if c.TLS != nil {
+		opts = append(opts, nats.Secure(&tls.Config{
+			ServerName:         c.TLS.ServerName,
+			InsecureSkipVerify: c.TLS.InsecureSkipVerify, // nolint:gosec
+			MinVersion:         tls.VersionTLS12,
+		}))
+
+		if c.TLS.CAFile != "" {
+			opts = append(opts, nats.RootCAs(c.TLS.CAFile))
+		}
+
+		if c.TLS.CertFile != "" {
+			opts = append(opts, nats.ClientCert(c.TLS.CertFile, c.TLS.KeyFile))
+		}
+	}
+
+	if c.MaxReconnects != nil {
+		opts = append(opts, nats.MaxReconnects(*c.MaxReconnects))
+	}
+
+	if c.ReconnectWait > 0 {
+		opts = append(opts, nats.ReconnectWait(c.ReconnectWait))
+	}
+
+	if c.ReconnectJitter > 0 || c.ReconnectJitterTLS > 0 {
+		jitter, jitterTLS := c.ReconnectJitter, c.ReconnectJitterTLS
+		if jitter == 0 {
+			jitter = nats.DefaultReconnectJitter
+		}
+		if jitterTLS == 0 {
+			jitterTLS = nats.DefaultReconnectJitterTLS
+		}
+		opts = append(opts, nats.ReconnectJitter(jitter, jitterTLS))
+	}
+
+	if c.PingInterval > 0 {
+		opts = append(opts, nats.PingInterval(c.PingInterval))
+	}
+
+	if c.ReconnectBufSize != 0 {
+		opts = append(opts, nats.ReconnectBufSize(c.ReconnectBufSize))
+	}
+
+	return opts, nil
+}
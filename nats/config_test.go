@@ -0,0 +1,133 @@
+package infranats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func Test_ConnectionConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *ConnectionConfig
+		wantErr bool
+	}{
+		{name: "nil", cfg: nil, wantErr: true},
+		{name: "valid", cfg: &ConnectionConfig{Address: "nats://localhost:4222"}},
+		{name: "no address", cfg: &ConnectionConfig{}, wantErr: true},
+		{name: "user and password", cfg: &ConnectionConfig{Address: "nats://localhost:4222", Username: "user", Password: "secret"}},
+		{name: "password without user", cfg: &ConnectionConfig{Address: "nats://localhost:4222", Password: "secret"}, wantErr: true},
+		{
+			name:    "several auth methods",
+			cfg:     &ConnectionConfig{Address: "nats://localhost:4222", Token: "token", CredentialsFile: "user.creds"},
+			wantErr: true,
+		},
+		{
+			name:    "cert without key",
+			cfg:     &ConnectionConfig{Address: "nats://localhost:4222", TLS: &TLSConfig{CertFile: "client.crt"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative reconnect wait",
+			cfg:     &ConnectionConfig{Address: "nats://localhost:4222", ReconnectWait: -time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "negative ping interval",
+			cfg:     &ConnectionConfig{Address: "nats://localhost:4222", PingInterval: -time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "invalid consumer",
+			cfg:     &ConnectionConfig{Address: "nats://localhost:4222", JetStream: &JetStreamConfig{Consumers: []*ConsumerConfig{{Stream: "events"}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ConnectionConfig_options(t *testing.T) {
+	maxReconnects := -1
+	cfg := &ConnectionConfig{
+		Address:          "nats://localhost:4222",
+		Name:             "service",
+		Username:         "user",
+		Password:         "secret",
+		TLS:              &TLSConfig{ServerName: "nats.local"},
+		MaxReconnects:    &maxReconnects,
+		ReconnectWait:    3 * time.Second,
+		ReconnectJitter:  200 * time.Millisecond,
+		PingInterval:     time.Minute,
+		ReconnectBufSize: -1,
+	}
+
+	opts, err := cfg.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		if err = opt(&got); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got.Name != "service" || got.User != "user" || got.Password != "secret" {
+		t.Errorf("unexpected name and credentials: %s %s %s", got.Name, got.User, got.Password)
+	}
+
+	if !got.Secure || got.TLSConfig == nil || got.TLSConfig.ServerName != "nats.local" {
+		t.Errorf("unexpected tls config: %v %+v", got.Secure, got.TLSConfig)
+	}
+
+	if got.MaxReconnect != -1 || got.ReconnectWait != 3*time.Second {
+		t.Errorf("unexpected reconnects: %d %s", got.MaxReconnect, got.ReconnectWait)
+	}
+
+	// the unset TLS jitter keeps the client default
+	if got.ReconnectJitter != 200*time.Millisecond || got.ReconnectJitterTLS != nats.DefaultReconnectJitterTLS {
+		t.Errorf("unexpected jitter: %s %s", got.ReconnectJitter, got.ReconnectJitterTLS)
+	}
+
+	if got.PingInterval != time.Minute || got.ReconnectBufSize != -1 {
+		t.Errorf("unexpected ping interval and buffer size: %s %d", got.PingInterval, got.ReconnectBufSize)
+	}
+}
+
+func Test_ConnectionConfig_options_defaults(t *testing.T) {
+	opts, err := (&ConnectionConfig{Address: "nats://localhost:4222"}).options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts) != 0 {
+		t.Errorf("expected client defaults, got %d options", len(opts))
+	}
+}
+
+func Test_ConnectionConfig_options_token(t *testing.T) {
+	opts, err := (&ConnectionConfig{Address: "nats://localhost:4222", Token: "token"}).options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		if err = opt(&got); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got.Token != "token" {
+		t.Errorf("unexpected token \"%s\"", got.Token)
+	}
+}
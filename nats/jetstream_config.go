@@ -0,0 +1,355 @@
+package infranats
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+// JetStreamConfig holds streams, durable consumers, key-value buckets and object stores declared on connect
+type JetStreamConfig struct {
+	Streams      []*StreamConfig      `mapstructure:"streams"`
+	Consumers    []*ConsumerConfig    `mapstructure:"consumers"`
+	KeyValues    []*KeyValueConfig    `mapstructure:"key_values"`
+	ObjectStores []*ObjectStoreConfig `mapstructure:"object_stores"`
+}
+
+type StreamConfig struct {
+	// Stream name
+	Name string `mapstructure:"name"`
+
+	// Subjects bound to the stream. Wildcards are allowed
+	Subjects []string `mapstructure:"subjects"`
+
+	// Retention policy: "limits" (default), "interest" or "workqueue"
+	Retention string `mapstructure:"retention"`
+
+	// Storage type: "file" (default) or "memory"
+	Storage string `mapstructure:"storage"`
+
+	// Number of stream replicas. Default is 1
+	Replicas int `mapstructure:"replicas"`
+
+	// Maximum age of messages. Unlimited if not set
+	MaxAge time.Duration `mapstructure:"max_age"`
+
+	// Maximum number of messages. Unlimited if not set
+	MaxMsgs int64 `mapstructure:"max_msgs"`
+
+	// Maximum stream size in bytes. Unlimited if not set
+	MaxBytes int64 `mapstructure:"max_bytes"`
+
+	// Window of duplicate messages tracking by "Nats-Msg-Id" header. Server default is used if not set
+	Duplicates time.Duration `mapstructure:"duplicates"`
+}
+
+type ConsumerConfig struct {
+	// Stream name
+	Stream string `mapstructure:"stream"`
+
+	// Durable consumer name
+	Durable string `mapstructure:"durable"`
+
+	// Subjects to consume. All stream subjects are consumed if not set
+	FilterSubjects []string `mapstructure:"filter_subjects"`
+
+	// Deliver policy: "all" (default), "new" or "last"
+	DeliverPolicy string `mapstructure:"deliver_policy"`
+
+	// Time the server waits for acknowledgement before redelivery. Server default is used if not set
+	AckWait time.Duration `mapstructure:"ack_wait"`
+
+	// Maximum number of delivery attempts. Unlimited if not set
+	MaxDeliver int `mapstructure:"max_deliver"`
+
+	// Redelivery delays. The last delay is used for all further attempts.
+	// Used by the server for unacknowledged messages and by PullConsumer for failed ones
+	Backoff []time.Duration `mapstructure:"backoff"`
+
+	// Maximum number of messages in progress. Server default is used if not set
+	MaxAckPending int `mapstructure:"max_ack_pending"`
+
+	// Number of messages processed concurrently by PullConsumer. Default is 1
+	Workers int `mapstructure:"workers"`
+
+	// Interval of "in progress" notifications sent by PullConsumer while the handler is running.
+	// Prevents redelivery of messages that take longer than AckWait. Disabled if not set
+	InProgressInterval time.Duration `mapstructure:"in_progress_interval"`
+}
+
+type KeyValueConfig struct {
+	// Bucket name
+	Bucket string `mapstructure:"bucket"`
+
+	// Maximum age of values. Unlimited if not set
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// Number of historical values kept per key. Default is 1, maximum is 64
+	History int `mapstructure:"history"`
+
+	// Number of bucket replicas. Default is 1
+	Replicas int `mapstructure:"replicas"`
+
+	// Maximum bucket size in bytes. Unlimited if not set
+	MaxBytes int64 `mapstructure:"max_bytes"`
+
+	// Storage type: "file" (default) or "memory"
+	Storage string `mapstructure:"storage"`
+}
+
+type ObjectStoreConfig struct {
+	// Bucket name
+	Bucket string `mapstructure:"bucket"`
+
+	// Maximum age of objects. Unlimited if not set
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// Number of bucket replicas. Default is 1
+	Replicas int `mapstructure:"replicas"`
+
+	// Maximum bucket size in bytes. Unlimited if not set
+	MaxBytes int64 `mapstructure:"max_bytes"`
+
+	// Storage type: "file" (default) or "memory"
+	Storage string `mapstructure:"storage"`
+}
+
+func (c *JetStreamConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	for i, stream := range c.Streams {
+		if err := stream.Validate(); err != nil {
+			return errors.Wrapf(err, "streams[%d]", i)
+		}
+	}
+
+	for i, consumer := range c.Consumers {
+		if err := consumer.Validate(); err != nil {
+			return errors.Wrapf(err, "consumers[%d]", i)
+		}
+	}
+
+	for i, kv := range c.KeyValues {
+		if err := kv.Validate(); err != nil {
+			return errors.Wrapf(err, "key_values[%d]", i)
+		}
+	}
+
+	for i, store := range c.ObjectStores {
+		if err := store.Validate(); err != nil {
+			return errors.Wrapf(err, "object_stores[%d]", i)
+		}
+	}
+
+	return nil
+}
+
+func (c *KeyValueConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty key-value config")
+	}
+
+	if c.Bucket == "" {
+		return errors.New("bucket is mandatory")
+	}
+
+	if c.History < 0 || c.History > jetstream.KeyValueMaxHistory {
+		return errors.Errorf("history must be between 1 and %d", jetstream.KeyValueMaxHistory)
+	}
+
+	if _, err := storageType(c.Storage); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ObjectStoreConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty object store config")
+	}
+
+	if c.Bucket == "" {
+		return errors.New("bucket is mandatory")
+	}
+
+	if _, err := storageType(c.Storage); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *StreamConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty stream config")
+	}
+
+	if c.Name == "" {
+		return errors.New("name is mandatory")
+	}
+
+	if len(c.Subjects) == 0 {
+		return errors.New("subjects are mandatory")
+	}
+
+	if _, err := c.retention(); err != nil {
+		return err
+	}
+
+	if _, err := storageType(c.Storage); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ConsumerConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty consumer config")
+	}
+
+	if c.Stream == "" {
+		return errors.New("stream is mandatory")
+	}
+
+	if c.Durable == "" {
+		return errors.New("durable is mandatory")
+	}
+
+	if _, err := c.deliverPolicy(); err != nil {
+		return err
+	}
+
+	if len(c.Backoff) > 0 && c.MaxDeliver > 0 && c.MaxDeliver <= len(c.Backoff) {
+		return errors.New("max_deliver must be greater than backoff length")
+	}
+
+	if c.Workers < 0 {
+		return errors.New("workers must not be negative")
+	}
+
+	return nil
+}
+
+func (c *StreamConfig) retention() (jetstream.RetentionPolicy, error) {
+	switch c.Retention {
+	case "", "limits":
+		return jetstream.LimitsPolicy, nil
+	case "interest":
+		return jetstream.InterestPolicy, nil
+	case "workqueue":
+		return jetstream.WorkQueuePolicy, nil
+	default:
+		return 0, errors.Errorf("invalid retention \"%s\"", c.Retention)
+	}
+}
+
+func storageType(storage string) (jetstream.StorageType, error) {
+	switch storage {
+	case "", "file":
+		return jetstream.FileStorage, nil
+	case "memory":
+		return jetstream.MemoryStorage, nil
+	default:
+		return 0, errors.Errorf("invalid storage \"%s\"", storage)
+	}
+}
+
+func (c *ConsumerConfig) deliverPolicy() (jetstream.DeliverPolicy, error) {
+	switch c.DeliverPolicy {
+	case "", "all":
+		return jetstream.DeliverAllPolicy, nil
+	case "new":
+		return jetstream.DeliverNewPolicy, nil
+	case "last":
+		return jetstream.DeliverLastPolicy, nil
+	default:
+		return 0, errors.Errorf("invalid deliver_policy \"%s\"", c.DeliverPolicy)
+	}
+}
+
+// jetStreamConfig converts the config to the jetstream stream config
+func (c *StreamConfig) jetStreamConfig() jetstream.StreamConfig {
+	retention, _ := c.retention()
+	storage, _ := storageType(c.Storage)
+
+	return jetstream.StreamConfig{
+		Name:       c.Name,
+		Subjects:   c.Subjects,
+		Retention:  retention,
+		Storage:    storage,
+		Replicas:   c.Replicas,
+		MaxAge:     c.MaxAge,
+		MaxMsgs:    maxOrUnlimited(c.MaxMsgs),
+		MaxBytes:   maxOrUnlimited(c.MaxBytes),
+		Duplicates: c.Duplicates,
+	}
+}
+
+func maxOrUnlimited(value int64) int64 {
+	if value <= 0 {
+		return -1
+	}
+
+	return value
+}
+
+// jetStreamConfig converts the config to the jetstream consumer config
+func (c *ConsumerConfig) jetStreamConfig() jetstream.ConsumerConfig {
+	deliverPolicy, _ := c.deliverPolicy()
+
+	return jetstream.ConsumerConfig{
+		Durable:        c.Durable,
+		FilterSubjects: c.FilterSubjects,
+		DeliverPolicy:  deliverPolicy,
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		AckWait:        c.AckWait,
+		MaxDeliver:     c.MaxDeliver,
+		BackOff:        c.Backoff,
+		MaxAckPending:  c.MaxAckPending,
+	}
+}
+
+// jetStreamConfig converts the config to the jetstream key-value config
+func (c *KeyValueConfig) jetStreamConfig() jetstream.KeyValueConfig {
+	storage, _ := storageType(c.Storage)
+
+	return jetstream.KeyValueConfig{
+		Bucket:   c.Bucket,
+		TTL:      c.TTL,
+		History:  uint8(c.History),
+		Replicas: c.Replicas,
+		MaxBytes: maxOrUnlimited(c.MaxBytes),
+		Storage:  storage,
+	}
+}
+
+// jetStreamConfig converts the config to the jetstream object store config
+func (c *ObjectStoreConfig) jetStreamConfig() jetstream.ObjectStoreConfig {
+	storage, _ := storageType(c.Storage)
+
+	return jetstream.ObjectStoreConfig{
+		Bucket:   c.Bucket,
+		TTL:      c.TTL,
+		Replicas: c.Replicas,
+		MaxBytes: maxOrUnlimited(c.MaxBytes),
+		Storage:  storage,
+	}
+}
+
+// nakDelay returns redelivery delay of a message delivered a given number of times
+func (c *ConsumerConfig) nakDelay(numDelivered uint64) time.Duration {
+	if len(c.Backoff) == 0 || numDelivered == 0 {
+		return 0
+	}
+
+	if numDelivered > uint64(len(c.Backoff)) {
+		return c.Backoff[len(c.Backoff)-1]
+	}
+
+	return c.Backoff[numDelivered-1]
+}
@@ -0,0 +1,82 @@
+package infranats
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ConsumerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *ConsumerConfig
+		wantErr bool
+	}{
+		{name: "nil", cfg: nil, wantErr: true},
+		{name: "valid", cfg: &ConsumerConfig{Stream: "events", Durable: "worker"}},
+		{name: "no stream", cfg: &ConsumerConfig{Durable: "worker"}, wantErr: true},
+		{name: "no durable", cfg: &ConsumerConfig{Stream: "events"}, wantErr: true},
+		{name: "deliver policy", cfg: &ConsumerConfig{Stream: "events", Durable: "worker", DeliverPolicy: "last"}},
+		{
+			name:    "invalid deliver policy",
+			cfg:     &ConsumerConfig{Stream: "events", Durable: "worker", DeliverPolicy: "first"},
+			wantErr: true,
+		},
+		{
+			name: "backoff with unlimited deliveries",
+			cfg:  &ConsumerConfig{Stream: "events", Durable: "worker", Backoff: []time.Duration{time.Second, time.Minute}},
+		},
+		{
+			name: "backoff shorter than max deliver",
+			cfg: &ConsumerConfig{
+				Stream:     "events",
+				Durable:    "worker",
+				Backoff:    []time.Duration{time.Second, time.Minute},
+				MaxDeliver: 3,
+			},
+		},
+		{
+			name: "backoff as long as max deliver",
+			cfg: &ConsumerConfig{
+				Stream:     "events",
+				Durable:    "worker",
+				Backoff:    []time.Duration{time.Second, time.Minute},
+				MaxDeliver: 2,
+			},
+			wantErr: true,
+		},
+		{name: "negative workers", cfg: &ConsumerConfig{Stream: "events", Durable: "worker", Workers: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ConsumerConfig_nakDelay(t *testing.T) {
+	cfg := &ConsumerConfig{Backoff: []time.Duration{time.Second, 5 * time.Second, time.Minute}}
+
+	tests := []struct {
+		numDelivered uint64
+		want         time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 5 * time.Second},
+		{3, time.Minute},
+		{10, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.nakDelay(tt.numDelivered); got != tt.want {
+			t.Errorf("nakDelay(%d) = %s, want %s", tt.numDelivered, got, tt.want)
+		}
+	}
+
+	if got := (&ConsumerConfig{}).nakDelay(3); got != 0 {
+		t.Errorf("nakDelay without backoff = %s, want 0", got)
+	}
+}
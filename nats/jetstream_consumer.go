@@ -0,0 +1,231 @@
+package infranats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+// JetStreamHandler processes a JetStream message.
+// The message is acknowledged if the handler returns nil and negatively acknowledged otherwise.
+// Use Term and NakWithDelay to control redelivery of a failed message.
+type JetStreamHandler func(ctx context.Context, msg jetstream.Msg) error
+
+type termError struct {
+	err error
+}
+
+func (e *termError) Error() string { return e.err.Error() }
+func (e *termError) Unwrap() error { return e.err }
+
+type nakDelayError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *nakDelayError) Error() string { return e.err.Error() }
+func (e *nakDelayError) Unwrap() error { return e.err }
+
+// Term wraps handler error to terminate the message. It will never be redelivered.
+func Term(err error) error {
+	return &termError{err: err}
+}
+
+// NakWithDelay wraps handler error to redeliver the message after a given delay
+func NakWithDelay(err error, delay time.Duration) error {
+	return &nakDelayError{err: err, delay: delay}
+}
+
+// PullConsumer runs a handler on messages of a durable pull consumer
+type PullConsumer struct {
+	js      jetstream.JetStream
+	cfg     *ConsumerConfig
+	handler JetStreamHandler
+
+	iter   jetstream.MessagesContext
+	cancel context.CancelFunc
+	// done is closed when all fetched messages are processed
+	done chan struct{}
+}
+
+var (
+	_ infraoperator.Starter = (*PullConsumer)(nil)
+	_ infraoperator.Stopper = (*PullConsumer)(nil)
+)
+
+// CreatePullConsumer creates a runner of a durable consumer declared in connection config
+func (cont *Container) CreatePullConsumer(
+	connectionName string,
+	stream string,
+	durable string,
+	handler JetStreamHandler,
+) (*PullConsumer, error) {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	cfg, ok := cont.cfg[connectionName]
+	if !ok {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	var consumerCfg *ConsumerConfig
+	if cfg.JetStream != nil {
+		for _, c := range cfg.JetStream.Consumers {
+			if c.Stream == stream && c.Durable == durable {
+				consumerCfg = c
+				break
+			}
+		}
+	}
+
+	if consumerCfg == nil {
+		return nil, errors.Errorf("consumer \"%s\" of stream \"%s\" is not declared", durable, stream)
+	}
+
+	return &PullConsumer{
+		js:      cont.js[connectionName],
+		cfg:     consumerCfg,
+		handler: handler,
+	}, nil
+}
+
+// Start starts consuming messages in background
+func (c *PullConsumer) Start(ctx context.Context) error {
+	consumer, err := c.js.Consumer(ctx, c.cfg.Stream, c.cfg.Durable)
+	if err != nil {
+		return errors.Wrapf(err, "can't get consumer \"%s\"", c.cfg.Durable)
+	}
+
+	workers := c.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	iter, err := consumer.Messages(jetstream.PullMaxMessages(workers))
+	if err != nil {
+		return errors.Wrapf(err, "can't consume \"%s\"", c.cfg.Durable)
+	}
+
+	handlerCtx, cancel := context.WithCancel(context.Background())
+	c.iter = iter
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	msgs := make(chan jetstream.Msg)
+
+	// the fetching goroutine is the only sender, so it closes msgs when the iterator is drained
+	go func() {
+		defer close(msgs)
+		for {
+			msg, err := iter.Next()
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return
+			}
+			if err != nil {
+				infralog.Error("jetstream consume error", zap.String("consumer", c.cfg.Durable), zap.Error(err))
+				continue
+			}
+			msgs <- msg
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				c.handle(handlerCtx, msg)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(c.done)
+	}()
+
+	return nil
+}
+
+// Stop drains the consumer and waits until messages in progress are processed.
+// Handlers' context is cancelled if ctx is done before that.
+func (c *PullConsumer) Stop(ctx context.Context) error {
+	if c.iter == nil {
+		return nil
+	}
+
+	c.iter.Drain()
+
+	select {
+	case <-c.done:
+		c.cancel()
+		return nil
+	case <-ctx.Done():
+		c.cancel()
+		return ctx.Err()
+	}
+}
+
+func (c *PullConsumer) handle(ctx context.Context, msg jetstream.Msg) {
+	ctx = extractHeaderContext(ctx, msg.Headers())
+
+	if c.cfg.InProgressInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			ticker := time.NewTicker(c.cfg.InProgressInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					if err := msg.InProgress(); err != nil {
+						infralog.ErrorCtx(ctx, "jetstream in progress error", zap.Error(err))
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	err := c.handler(ctx, msg)
+	if err == nil {
+		if err = msg.Ack(); err != nil && !errors.Is(err, jetstream.ErrMsgAlreadyAckd) {
+			infralog.ErrorCtx(ctx, "jetstream ack error", zap.Error(err))
+		}
+		return
+	}
+
+	infralog.ErrorCtx(ctx, "jetstream handler error", zap.String("subject", msg.Subject()), zap.Error(err))
+
+	var (
+		term     *termError
+		nakDelay *nakDelayError
+	)
+
+	switch {
+	case errors.As(err, &term):
+		err = msg.TermWithReason(term.Error())
+	case errors.As(err, &nakDelay):
+		err = msg.NakWithDelay(nakDelay.delay)
+	default:
+		var numDelivered uint64
+		if meta, metaErr := msg.Metadata(); metaErr == nil {
+			numDelivered = meta.NumDelivered
+		}
+		err = msg.NakWithDelay(c.cfg.nakDelay(numDelivered))
+	}
+
+	if err != nil && !errors.Is(err, jetstream.ErrMsgAlreadyAckd) {
+		infralog.ErrorCtx(ctx, "jetstream nak error", zap.Error(err))
+	}
+}
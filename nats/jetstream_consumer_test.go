@@ -0,0 +1,121 @@
+package infranats
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func startPullConsumer(t *testing.T, name string, handler JetStreamHandler, messages int) (*Container, *PullConsumer) {
+	t.Helper()
+
+	_, cont := runServer(t, name, &JetStreamConfig{
+		Streams:   []*StreamConfig{{Name: "events", Subjects: []string{"events.>"}}},
+		Consumers: []*ConsumerConfig{{Stream: "events", Durable: "worker", Workers: 2}},
+	})
+
+	for i := 0; i < messages; i++ {
+		if _, err := cont.JetStream(name).Publish(context.Background(), "events.created", []byte("event")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	consumer, err := cont.CreatePullConsumer(name, "events", "worker", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = consumer.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return cont, consumer
+}
+
+func Test_PullConsumer(t *testing.T) {
+	var handled atomic.Int64
+	all := make(chan struct{})
+
+	cont, consumer := startPullConsumer(t, "consumer", func(ctx context.Context, msg jetstream.Msg) error {
+		if handled.Add(1) == 5 {
+			close(all)
+		}
+		return nil
+	}, 5)
+
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("handled %d messages, want 5", handled.Load())
+	}
+
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// acknowledgements are processed by the server asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := cont.JetStream("consumer").Consumer(context.Background(), "events", "worker")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		acked := info.CachedInfo().AckFloor.Stream
+		if acked == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("acknowledged %d messages, want 5", acked)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_PullConsumer_StopWhileConsuming(t *testing.T) {
+	started := make(chan struct{}, 100)
+
+	_, consumer := startPullConsumer(t, "consumer_stop", func(ctx context.Context, msg jetstream.Msg) error {
+		started <- struct{}{}
+		time.Sleep(time.Millisecond)
+		return nil
+	}, 100)
+
+	<-started
+
+	// messages are still fetched while the consumer is drained
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_PullConsumer_StopTimeout(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+
+	_, consumer := startPullConsumer(t, "consumer_timeout", func(ctx context.Context, msg jetstream.Msg) error {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}, 1)
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := consumer.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop returned %v, want deadline exceeded", err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler context is not canceled")
+	}
+}
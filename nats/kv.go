@@ -0,0 +1,222 @@
+package infranats
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"go.uber.org/zap"
+)
+
+const watchRestartDelay = time.Second
+
+// KeyValue gets a JetStream key-value bucket of a connection from a container
+func (cont *Container) KeyValue(ctx context.Context, name string, bucket string) (jetstream.KeyValue, error) {
+	js := cont.JetStream(name)
+	if js == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", name)
+	}
+
+	return js.KeyValue(ctx, bucket)
+}
+
+// ObjectStore gets a JetStream object store of a connection from a container
+func (cont *Container) ObjectStore(ctx context.Context, name string, bucket string) (jetstream.ObjectStore, error) {
+	js := cont.JetStream(name)
+	if js == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", name)
+	}
+
+	return js.ObjectStore(ctx, bucket)
+}
+
+// TypedKeyValue is a typed accessor of a key-value bucket. Values are encoded as JSON.
+type TypedKeyValue[T any] struct {
+	kv   jetstream.KeyValue
+	conn *nats.Conn
+}
+
+// KeyValueEvent is a change of a key in a key-value bucket
+type KeyValueEvent[T any] struct {
+	Key      string
+	Value    T
+	Revision uint64
+
+	// Deleted is true if the key was deleted or purged. Value is empty in that case
+	Deleted bool
+}
+
+// NewTypedKeyValue creates a typed accessor of a key-value bucket.
+// conn is used to restart watchers after reconnects and may be nil.
+func NewTypedKeyValue[T any](kv jetstream.KeyValue, conn *nats.Conn) *TypedKeyValue[T] {
+	return &TypedKeyValue[T]{
+		kv:   kv,
+		conn: conn,
+	}
+}
+
+// GetTypedKeyValue gets a typed accessor of a key-value bucket of a connection from a container
+func GetTypedKeyValue[T any](ctx context.Context, cont *Container, name string, bucket string) (*TypedKeyValue[T], error) {
+	kv, err := cont.KeyValue(ctx, name, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTypedKeyValue[T](kv, cont.Get(name)), nil
+}
+
+// Bucket returns the underlying key-value bucket
+func (t *TypedKeyValue[T]) Bucket() jetstream.KeyValue {
+	return t.kv
+}
+
+// Get returns the latest value of a key and its revision.
+// jetstream.ErrKeyNotFound is returned if the key doesn't exist or is deleted.
+func (t *TypedKeyValue[T]) Get(ctx context.Context, key string) (T, uint64, error) {
+	var value T
+
+	entry, err := t.kv.Get(ctx, key)
+	if err != nil {
+		return value, 0, err
+	}
+
+	if err = json.Unmarshal(entry.Value(), &value); err != nil {
+		return value, 0, errors.Wrapf(err, "can't decode value of \"%s\"", key)
+	}
+
+	return value, entry.Revision(), nil
+}
+
+// Put sets a value of a key and returns its new revision
+func (t *TypedKeyValue[T]) Put(ctx context.Context, key string, value T) (uint64, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't encode value of \"%s\"", key)
+	}
+
+	return t.kv.Put(ctx, key, data)
+}
+
+// Update sets a value of a key only if its latest revision is equal to a given one
+func (t *TypedKeyValue[T]) Update(ctx context.Context, key string, value T, revision uint64) (uint64, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't encode value of \"%s\"", key)
+	}
+
+	return t.kv.Update(ctx, key, data, revision)
+}
+
+// Delete deletes a key
+func (t *TypedKeyValue[T]) Delete(ctx context.Context, key string) error {
+	return t.kv.Delete(ctx, key)
+}
+
+// Watch delivers current values and all further changes of keys matching a given pattern.
+// The watcher is restarted from the last seen revision if it fails or the connection is re-established.
+// The channel is closed when ctx is done.
+func (t *TypedKeyValue[T]) Watch(ctx context.Context, keys string) (<-chan KeyValueEvent[T], error) {
+	watcher, err := t.kv.Watch(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var reconnected chan nats.Status
+	if t.conn != nil {
+		reconnected = t.conn.StatusChanged(nats.CONNECTED)
+	}
+
+	events := make(chan KeyValueEvent[T])
+	go func() {
+		defer close(events)
+		if reconnected != nil {
+			defer t.conn.RemoveStatusListener(reconnected)
+		}
+
+		var lastRevision uint64
+		for {
+			lastRevision = t.watch(ctx, watcher, events, reconnected, lastRevision)
+			_ = watcher.Stop()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			// restart the watcher from the next revision or from current values if nothing is delivered yet
+			for {
+				var opts []jetstream.WatchOpt
+				if lastRevision > 0 {
+					opts = append(opts, jetstream.ResumeFromRevision(lastRevision+1))
+				}
+
+				watcher, err = t.kv.Watch(ctx, keys, opts...)
+				if err == nil {
+					break
+				}
+
+				infralog.Error("can't restart key-value watcher", zap.String("keys", keys), zap.Error(err))
+
+				select {
+				case <-time.After(watchRestartDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// watch delivers updates of a watcher until it stops, the connection is re-established or ctx is done.
+// Returns the last delivered revision.
+func (t *TypedKeyValue[T]) watch(
+	ctx context.Context,
+	watcher jetstream.KeyWatcher,
+	events chan<- KeyValueEvent[T],
+	reconnected <-chan nats.Status,
+	lastRevision uint64,
+) uint64 {
+	for {
+		select {
+		case <-ctx.Done():
+			return lastRevision
+		case <-reconnected:
+			return lastRevision
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return lastRevision
+			}
+
+			// nil entry marks the end of initial values
+			if entry == nil {
+				continue
+			}
+
+			event := KeyValueEvent[T]{
+				Key:      entry.Key(),
+				Revision: entry.Revision(),
+				Deleted:  entry.Operation() != jetstream.KeyValuePut,
+			}
+
+			if !event.Deleted {
+				if err := json.Unmarshal(entry.Value(), &event.Value); err != nil {
+					infralog.Error("can't decode key-value entry", zap.String("key", entry.Key()), zap.Error(err))
+					lastRevision = entry.Revision()
+					continue
+				}
+			}
+
+			select {
+			case events <- event:
+				lastRevision = entry.Revision()
+			case <-ctx.Done():
+				return lastRevision
+			}
+		}
+	}
+}
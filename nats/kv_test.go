@@ -0,0 +1,184 @@
+package infranats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type setting struct {
+	Value string `json:"value"`
+}
+
+var settingsConfig = &JetStreamConfig{KeyValues: []*KeyValueConfig{{Bucket: "settings"}}}
+
+func getSettings(t *testing.T, cont *Container, name string) *TypedKeyValue[setting] {
+	t.Helper()
+
+	kv, err := GetTypedKeyValue[setting](context.Background(), cont, name, "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return kv
+}
+
+func nextEvent(t *testing.T, events <-chan KeyValueEvent[setting]) KeyValueEvent[setting] {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events channel is closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event is delivered")
+		return KeyValueEvent[setting]{}
+	}
+}
+
+func Test_TypedKeyValue(t *testing.T) {
+	ctx := context.Background()
+	_, cont := runServer(t, "kv", settingsConfig)
+	kv := getSettings(t, cont, "kv")
+
+	revision, err := kv.Put(ctx, "mode", setting{Value: "fast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, got, err := kv.Get(ctx, "mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Value != "fast" || got != revision {
+		t.Errorf("Get = %+v, %d, want fast, %d", value, got, revision)
+	}
+
+	if _, err = kv.Update(ctx, "mode", setting{Value: "slow"}, revision+1); err == nil {
+		t.Error("update of a stale revision succeeded")
+	}
+
+	if _, err = kv.Update(ctx, "mode", setting{Value: "slow"}, revision); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = kv.Delete(ctx, "mode"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = kv.Get(ctx, "mode"); !errors.Is(err, jetstream.ErrKeyNotFound) {
+		t.Errorf("Get of a deleted key returned %v", err)
+	}
+
+	// values which are not JSON can't be decoded
+	if _, err = kv.Bucket().PutString(ctx, "raw", "not json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = kv.Get(ctx, "raw"); err == nil {
+		t.Error("Get decoded an invalid value")
+	}
+}
+
+func Test_TypedKeyValue_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, cont := runServer(t, "kv_watch", settingsConfig)
+	kv := getSettings(t, cont, "kv_watch")
+
+	if _, err := kv.Put(ctx, "a", setting{Value: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := kv.Watch(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// current values are delivered first
+	if event := nextEvent(t, events); event.Key != "a" || event.Value.Value != "1" || event.Deleted {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	if _, err = kv.Put(ctx, "b", setting{Value: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Key != "b" || event.Value.Value != "2" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	if err = kv.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Key != "a" || !event.Deleted {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("event is delivered after ctx is done")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("events channel is not closed")
+	}
+}
+
+func Test_TypedKeyValue_WatchRestartsAfterReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := startServer(t, -1, t.TempDir())
+
+	cont := NewContainer()
+	err := cont.Connect("kv_reconnect", &ConnectionConfig{
+		Address:       srv.ClientURL(),
+		ReconnectWait: 10 * time.Millisecond,
+		JetStream:     settingsConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cont.Close()
+
+	kv := getSettings(t, cont, "kv_reconnect")
+
+	if _, err = kv.Put(ctx, "a", setting{Value: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := kv.Watch(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event := nextEvent(t, events); event.Key != "a" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	reconnected := cont.Get("kv_reconnect").StatusChanged(nats.CONNECTED)
+	restartServer(t, srv)
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection is not re-established")
+	}
+
+	if _, err = kv.Put(ctx, "b", setting{Value: "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the watcher resumes after the last delivered revision, so "a" is not delivered again
+	if event := nextEvent(t, events); event.Key != "b" || event.Value.Value != "2" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,154 @@
+package infranats
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "nats"
+
+// StatsCollector is a prometheus collector of a NATS connection statistics
+type StatsCollector struct {
+	conn          *nats.Conn
+	slowConsumers atomic.Uint64
+
+	mu   sync.Mutex
+	subs []*nats.Subscription
+
+	inMsgs        *prometheus.Desc
+	outMsgs       *prometheus.Desc
+	inBytes       *prometheus.Desc
+	outBytes      *prometheus.Desc
+	reconnects    *prometheus.Desc
+	status        *prometheus.Desc
+	slowConsumer  *prometheus.Desc
+	pendingMsgs   *prometheus.Desc
+	pendingBytes  *prometheus.Desc
+	droppedMsgs   *prometheus.Desc
+	deliveredMsgs *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*StatsCollector)(nil)
+
+func newStatsCollector(name string) *StatsCollector {
+	labels := prometheus.Labels{"connection": name}
+	subLabels := []string{"subject", "queue"}
+
+	desc := func(name string, help string, variableLabels []string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", name), help, variableLabels, labels)
+	}
+
+	return &StatsCollector{
+		inMsgs:        desc("in_msgs_total", "The total number of received messages", nil),
+		outMsgs:       desc("out_msgs_total", "The total number of sent messages", nil),
+		inBytes:       desc("in_bytes_total", "The total number of received bytes", nil),
+		outBytes:      desc("out_bytes_total", "The total number of sent bytes", nil),
+		reconnects:    desc("reconnects_total", "The total number of reconnects", nil),
+		status:        desc("connection_status", "The connection status, 1 for the current one", []string{"status"}),
+		slowConsumer:  desc("slow_consumer_events_total", "The total number of slow consumer errors", nil),
+		pendingMsgs:   desc("subscription_pending_msgs", "The number of messages pending in a subscription buffer", subLabels),
+		pendingBytes:  desc("subscription_pending_bytes", "The number of bytes pending in a subscription buffer", subLabels),
+		droppedMsgs:   desc("subscription_dropped_msgs_total", "The total number of messages dropped by a subscription", subLabels),
+		deliveredMsgs: desc("subscription_delivered_msgs_total", "The total number of messages delivered to a subscription", subLabels),
+	}
+}
+
+// Track adds a subscription to the collected ones. Closed subscriptions are forgotten automatically
+func (c *StatsCollector) Track(sub *nats.Subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subs = append(c.subs, sub)
+}
+
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.inMsgs
+	ch <- c.outMsgs
+	ch <- c.inBytes
+	ch <- c.outBytes
+	ch <- c.reconnects
+	ch <- c.status
+	ch <- c.slowConsumer
+	ch <- c.pendingMsgs
+	ch <- c.pendingBytes
+	ch <- c.droppedMsgs
+	ch <- c.deliveredMsgs
+}
+
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	connStats := c.conn.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.inMsgs, prometheus.CounterValue, float64(connStats.InMsgs))
+	ch <- prometheus.MustNewConstMetric(c.outMsgs, prometheus.CounterValue, float64(connStats.OutMsgs))
+	ch <- prometheus.MustNewConstMetric(c.inBytes, prometheus.CounterValue, float64(connStats.InBytes))
+	ch <- prometheus.MustNewConstMetric(c.outBytes, prometheus.CounterValue, float64(connStats.OutBytes))
+	ch <- prometheus.MustNewConstMetric(c.reconnects, prometheus.CounterValue, float64(connStats.Reconnects))
+	ch <- prometheus.MustNewConstMetric(c.slowConsumer, prometheus.CounterValue, float64(c.slowConsumers.Load()))
+
+	current := c.conn.Status()
+	for _, status := range []nats.Status{
+		nats.DISCONNECTED,
+		nats.CONNECTED,
+		nats.CLOSED,
+		nats.RECONNECTING,
+		nats.CONNECTING,
+		nats.DRAINING_SUBS,
+		nats.DRAINING_PUBS,
+	} {
+		var value float64
+		if status == current {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.status, prometheus.GaugeValue, value, status.String())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// subscriptions of the same subject and queue are summed up to keep label values unique
+	type subKey struct{ subject, queue string }
+	type subStats struct{ msgs, bytes, dropped, delivered float64 }
+
+	stats := make(map[subKey]*subStats)
+	subs := c.subs[:0]
+	for _, sub := range c.subs {
+		if !sub.IsValid() {
+			continue
+		}
+		subs = append(subs, sub)
+
+		msgs, bytes, err := sub.Pending()
+		if err != nil {
+			continue
+		}
+		dropped, _ := sub.Dropped()
+		delivered, _ := sub.Delivered()
+
+		key := subKey{sub.Subject, sub.Queue}
+		s, ok := stats[key]
+		if !ok {
+			s = &subStats{}
+			stats[key] = s
+		}
+		s.msgs += float64(msgs)
+		s.bytes += float64(bytes)
+		s.dropped += float64(dropped)
+		s.delivered += float64(delivered)
+	}
+
+	for key, s := range stats {
+		ch <- prometheus.MustNewConstMetric(c.pendingMsgs, prometheus.GaugeValue, s.msgs, key.subject, key.queue)
+		ch <- prometheus.MustNewConstMetric(c.pendingBytes, prometheus.GaugeValue, s.bytes, key.subject, key.queue)
+		ch <- prometheus.MustNewConstMetric(c.droppedMsgs, prometheus.CounterValue, s.dropped, key.subject, key.queue)
+		ch <- prometheus.MustNewConstMetric(c.deliveredMsgs, prometheus.CounterValue, s.delivered, key.subject, key.queue)
+	}
+
+	// forget closed subscriptions
+	for i := len(subs); i < len(c.subs); i++ {
+		c.subs[i] = nil
+	}
+	c.subs = subs
+}
@@ -0,0 +1,105 @@
+package infranats
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_StatsCollector(t *testing.T) {
+	_, cont := runServer(t, "metrics", nil)
+	conn := cont.Get("metrics")
+
+	sub, err := conn.SubscribeSync("test.metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont.TrackSubscription("metrics", sub)
+
+	for i := 0; i < 3; i++ {
+		if err = conn.Publish("test.metrics", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = sub.NextMsg(time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `
+# HELP nats_connection_status The connection status, 1 for the current one
+# TYPE nats_connection_status gauge
+nats_connection_status{connection="metrics",status="CLOSED"} 0
+nats_connection_status{connection="metrics",status="CONNECTED"} 1
+nats_connection_status{connection="metrics",status="CONNECTING"} 0
+nats_connection_status{connection="metrics",status="DISCONNECTED"} 0
+nats_connection_status{connection="metrics",status="DRAINING_PUBS"} 0
+nats_connection_status{connection="metrics",status="DRAINING_SUBS"} 0
+nats_connection_status{connection="metrics",status="RECONNECTING"} 0
+# HELP nats_subscription_delivered_msgs_total The total number of messages delivered to a subscription
+# TYPE nats_subscription_delivered_msgs_total counter
+nats_subscription_delivered_msgs_total{connection="metrics",queue="",subject="test.metrics"} 2
+# HELP nats_subscription_pending_msgs The number of messages pending in a subscription buffer
+# TYPE nats_subscription_pending_msgs gauge
+nats_subscription_pending_msgs{connection="metrics",queue="",subject="test.metrics"} 1
+`
+	err = testutil.CollectAndCompare(cont.GetCollector("metrics"), strings.NewReader(expected),
+		"nats_connection_status", "nats_subscription_delivered_msgs_total", "nats_subscription_pending_msgs")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// closed subscriptions are forgotten
+	if err = sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(cont.GetCollector("metrics"), "nats_subscription_pending_msgs"); n != 0 {
+		t.Errorf("collected %d metrics of a closed subscription", n)
+	}
+}
+
+func Test_Connect_sameNameInAnotherContainer(t *testing.T) {
+	srv, _ := runServer(t, "shared", nil)
+
+	cont := NewContainer()
+	if err := cont.Connect("shared", &ConnectionConfig{Address: srv.ClientURL()}); err != nil {
+		t.Fatal(err)
+	}
+	defer cont.Close()
+
+	// the collector of the latest connection replaces the registered one
+	if !prometheus.Unregister(cont.GetCollector("shared")) {
+		t.Error("collector of the second container is not registered")
+	}
+}
+
+func Test_Container_Check(t *testing.T) {
+	srv, cont := runServer(t, "check", nil)
+
+	if err := cont.Check(context.Background()); err != nil {
+		t.Fatalf("connected container check failed: %v", err)
+	}
+
+	srv.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cont.Check(context.Background()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("check succeeded after the server is shut down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a reconnecting connection can't be drained, so it's closed before the container
+	cont.Get("check").Close()
+}
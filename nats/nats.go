@@ -1,31 +1,47 @@
 package infranats
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
 	"go.uber.org/zap"
 )
 
+const declareTimeout = 30 * time.Second
+
 // Container is a simple container for holding named NATS connections.
 type Container struct {
 	mu *sync.RWMutex
 
-	cfg  map[string]*ConnectionConfig
-	pool map[string]*nats.Conn
+	cfg        map[string]*ConnectionConfig
+	pool       map[string]*nats.Conn
+	js         map[string]jetstream.JetStream
+	collectors map[string]*StatsCollector
+
+	routers []*Router
 
 	wg sync.WaitGroup
 }
 
 func NewContainer() *Container {
 	return &Container{
-		mu:   &sync.RWMutex{},
-		cfg:  make(map[string]*ConnectionConfig),
-		pool: make(map[string]*nats.Conn),
+		mu:         &sync.RWMutex{},
+		cfg:        make(map[string]*ConnectionConfig),
+		pool:       make(map[string]*nats.Conn),
+		js:         make(map[string]jetstream.JetStream),
+		collectors: make(map[string]*StatsCollector),
 	}
 }
 
+var _ infraoperator.Checker = (*Container)(nil)
+
 func connErrHandler(conn *nats.Conn, err error) {
 	if err == nil {
 		return
@@ -34,36 +50,99 @@ func connErrHandler(conn *nats.Conn, err error) {
 	infralog.Error("nats connection error", zap.Error(err))
 }
 
-func errHandler(conn *nats.Conn, sub *nats.Subscription, err error) {
-	if err == nil {
-		return
+func errHandler(collector *StatsCollector) nats.ErrHandler {
+	return func(conn *nats.Conn, sub *nats.Subscription, err error) {
+		if err == nil {
+			return
+		}
+
+		if errors.Is(err, nats.ErrSlowConsumer) {
+			collector.slowConsumers.Add(1)
+		}
+
+		infralog.Error("nats error", zap.Error(err))
 	}
+}
 
-	infralog.Error("nats error", zap.Error(err))
+func reconnectHandler(name string) nats.ConnHandler {
+	return func(conn *nats.Conn) {
+		infralog.Info("nats reconnected",
+			zap.String("connection", name),
+			zap.String("url", conn.ConnectedUrlRedacted()),
+			zap.Uint64("reconnects", conn.Stats().Reconnects))
+	}
 }
 
 // Connect creates a new named NATS connection
 func (cont *Container) Connect(name string, cfg *ConnectionConfig) error {
+	opts, err := cfg.options()
+	if err != nil {
+		return err
+	}
+
+	collector := newStatsCollector(name)
+
+	opts = append(opts,
+		nats.DisconnectErrHandler(connErrHandler),
+		nats.ErrorHandler(errHandler(collector)),
+		nats.ReconnectHandler(reconnectHandler(name)),
+	)
+
 	cont.wg.Add(1)
 
-	conn, err := nats.Connect(cfg.Address, nats.DisconnectErrHandler(connErrHandler), nats.ErrorHandler(errHandler),
+	conn, err := nats.Connect(cfg.Address, append(opts,
 		nats.ClosedHandler(func(conn *nats.Conn) {
 			cont.wg.Done()
-		}))
+		}))...)
 	if err != nil {
 		cont.wg.Done()
 		return err
 	}
 
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "jetstream.New")
+	}
+
+	if err = declareJetStream(js, cfg.JetStream); err != nil {
+		conn.Close()
+		return errors.Wrap(err, "jetstream")
+	}
+
+	if old := cont.GetCollector(name); old != nil {
+		prometheus.Unregister(old)
+	}
+	collector.conn = conn
+	registerCollector(collector)
+
 	cont.mu.Lock()
 	defer cont.mu.Unlock()
 
 	cont.pool[name] = conn
+	cont.js[name] = js
 	cont.cfg[name] = cfg
+	cont.collectors[name] = collector
 
 	return nil
 }
 
+// registerCollector registers a collector replacing a collector of the same connection name
+// registered by another container, so the latest connection is collected
+func registerCollector(collector *StatsCollector) {
+	err := prometheus.Register(collector)
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		prometheus.Unregister(registered.ExistingCollector)
+		err = prometheus.Register(collector)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
 // Get gets connection from a container
 func (cont *Container) Get(name string) *nats.Conn {
 	cont.mu.RLock()
@@ -72,11 +151,58 @@ func (cont *Container) Get(name string) *nats.Conn {
 	return cont.pool[name]
 }
 
-// Close drains all connection from a container
+// JetStream gets JetStream context of a connection from a container
+func (cont *Container) JetStream(name string) jetstream.JetStream {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	return cont.js[name]
+}
+
+// GetCollector gets metrics collector of a connection from a container
+func (cont *Container) GetCollector(name string) *StatsCollector {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	return cont.collectors[name]
+}
+
+// TrackSubscription adds a subscription to metrics of a connection.
+// Subscriptions of routers are tracked automatically.
+func (cont *Container) TrackSubscription(name string, sub *nats.Subscription) {
+	if collector := cont.GetCollector(name); collector != nil {
+		collector.Track(sub)
+	}
+}
+
+// Check returns an error if any connection of a container is not connected
+func (cont *Container) Check(_ context.Context) error {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	for name, conn := range cont.pool {
+		if status := conn.Status(); status != nats.CONNECTED {
+			return errors.Errorf("nats connection \"%s\" is %s", name, status)
+		}
+	}
+
+	return nil
+}
+
+// Close drains all routers and connections from a container
 func (cont *Container) Close() {
 	cont.mu.RLock()
 	defer cont.mu.RUnlock()
 
+	ctx, cancel := context.WithTimeout(context.Background(), routerDrainTimeout)
+	defer cancel()
+
+	for _, router := range cont.routers {
+		if err := router.Stop(ctx); err != nil {
+			infralog.Error("can't drain router", zap.String("connection", router.connectionName), zap.Error(err))
+		}
+	}
+
 	for _, conn := range cont.pool {
 		err := conn.Drain()
 		if err != nil {
@@ -86,3 +212,39 @@ func (cont *Container) Close() {
 
 	cont.wg.Wait()
 }
+
+// declareJetStream creates or updates streams, consumers, key-value buckets and object stores declared in config
+func declareJetStream(js jetstream.JetStream, cfg *JetStreamConfig) error {
+	if cfg == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), declareTimeout)
+	defer cancel()
+
+	for _, stream := range cfg.Streams {
+		if _, err := js.CreateOrUpdateStream(ctx, stream.jetStreamConfig()); err != nil {
+			return errors.Wrapf(err, "can't declare stream \"%s\"", stream.Name)
+		}
+	}
+
+	for _, consumer := range cfg.Consumers {
+		if _, err := js.CreateOrUpdateConsumer(ctx, consumer.Stream, consumer.jetStreamConfig()); err != nil {
+			return errors.Wrapf(err, "can't declare consumer \"%s\" of stream \"%s\"", consumer.Durable, consumer.Stream)
+		}
+	}
+
+	for _, kv := range cfg.KeyValues {
+		if _, err := js.CreateOrUpdateKeyValue(ctx, kv.jetStreamConfig()); err != nil {
+			return errors.Wrapf(err, "can't declare key-value bucket \"%s\"", kv.Bucket)
+		}
+	}
+
+	for _, store := range cfg.ObjectStores {
+		if _, err := js.CreateOrUpdateObjectStore(ctx, store.jetStreamConfig()); err != nil {
+			return errors.Wrapf(err, "can't declare object store \"%s\"", store.Bucket)
+		}
+	}
+
+	return nil
+}
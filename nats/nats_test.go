@@ -0,0 +1,52 @@
+package infranats
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+)
+
+// runServer runs an embedded NATS server with JetStream enabled and connects a container to it
+func runServer(t *testing.T, name string, js *JetStreamConfig) (*server.Server, *Container) {
+	t.Helper()
+
+	srv := startServer(t, -1, t.TempDir())
+
+	cont := NewContainer()
+	if err := cont.Connect(name, &ConnectionConfig{Address: srv.ClientURL(), JetStream: js}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cont.Close)
+
+	return srv, cont
+}
+
+// restartServer shuts a server down and runs it again on the same port with the same JetStream storage
+func restartServer(t *testing.T, srv *server.Server) *server.Server {
+	t.Helper()
+
+	port := srv.Addr().(*net.TCPAddr).Port
+	storeDir := filepath.Dir(srv.StoreDir())
+
+	srv.Shutdown()
+	srv.WaitForShutdown()
+
+	return startServer(t, port, storeDir)
+}
+
+func startServer(t *testing.T, port int, storeDir string) *server.Server {
+	t.Helper()
+
+	opts := natsserver.DefaultTestOptions
+	opts.Port = port
+	opts.JetStream = true
+	opts.StoreDir = storeDir
+
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	return srv
+}
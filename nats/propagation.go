@@ -0,0 +1,46 @@
+package infranats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pushwoosh/infra/propagation"
+)
+
+// headerCarrier adapts NATS message headers to the propagation carrier
+type headerCarrier nats.Header
+
+func (c headerCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// InjectContext puts trace context, request id and registered log fields of the context into message headers
+func InjectContext(ctx context.Context, msg *nats.Msg) {
+	if msg.Header == nil {
+		msg.Header = make(nats.Header)
+	}
+
+	infrapropagation.Inject(ctx, headerCarrier(msg.Header))
+}
+
+// ExtractContext restores trace context, request id and log fields from message headers
+func ExtractContext(ctx context.Context, msg *nats.Msg) context.Context {
+	return extractHeaderContext(ctx, msg.Header)
+}
+
+func extractHeaderContext(ctx context.Context, header nats.Header) context.Context {
+	return infrapropagation.Extract(ctx, headerCarrier(header))
+}
@@ -0,0 +1,189 @@
+package infranats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderError is set on replies of failed request handlers
+	HeaderError = "x-error"
+
+	routerDrainTimeout = 30 * time.Second
+)
+
+// MsgHandler processes a message. For request/reply subjects the returned data is sent as a reply.
+// If the handler fails, an empty reply with HeaderError header is sent.
+type MsgHandler func(ctx context.Context, msg *nats.Msg) ([]byte, error)
+
+// Middleware wraps a message handler
+type Middleware func(next MsgHandler) MsgHandler
+
+// Route describes a subscription a message is handled by
+type Route struct {
+	Connection string
+	Subject    string
+	Queue      string
+}
+
+type routeCtxKey struct{}
+
+// RouteFromContext returns a route of a message being handled
+func RouteFromContext(ctx context.Context) (Route, bool) {
+	route, ok := ctx.Value(routeCtxKey{}).(Route)
+	return route, ok
+}
+
+// Router dispatches messages of subjects to handlers wrapped in a middleware chain
+type Router struct {
+	conn           *nats.Conn
+	connectionName string
+	collector      *StatsCollector
+
+	mu          sync.Mutex
+	middlewares []Middleware
+	subs        []*routerSub
+}
+
+// routerSub is a subscription of a route. closed is closed by the client
+// once the subscription is drained and its last handler has returned.
+type routerSub struct {
+	sub    *nats.Subscription
+	closed chan struct{}
+}
+
+var _ infraoperator.Stopper = (*Router)(nil)
+
+// CreateRouter creates a router of a connection by a connection name.
+// Middlewares are applied to all handlers in the given order, the first one is the outermost.
+// The router is drained by Container.Close.
+func (cont *Container) CreateRouter(connectionName string, middlewares ...Middleware) (*Router, error) {
+	cont.mu.Lock()
+	defer cont.mu.Unlock()
+
+	conn, ok := cont.pool[connectionName]
+	if !ok {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	router := &Router{
+		conn:           conn,
+		connectionName: connectionName,
+		collector:      cont.collectors[connectionName],
+		middlewares:    middlewares,
+	}
+	cont.routers = append(cont.routers, router)
+
+	return router, nil
+}
+
+// Use adds middlewares applied to handlers registered after the call
+func (r *Router) Use(middlewares ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Handle subscribes a handler to a subject pattern. Wildcards are allowed.
+// Messages are distributed among subscribers of the same non-empty queue group.
+// middlewares are applied after the router ones.
+func (r *Router) Handle(subject string, queue string, handler MsgHandler, middlewares ...Middleware) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	handler = chainMiddlewares(handler, r.middlewares, middlewares)
+
+	route := Route{
+		Connection: r.connectionName,
+		Subject:    subject,
+		Queue:      queue,
+	}
+
+	sub, err := r.conn.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		r.dispatch(route, handler, msg)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't subscribe to \"%s\"", subject)
+	}
+
+	closed := make(chan struct{})
+	sub.SetClosedHandler(func(string) { close(closed) })
+
+	r.subs = append(r.subs, &routerSub{sub: sub, closed: closed})
+	if r.collector != nil {
+		r.collector.Track(sub)
+	}
+
+	return nil
+}
+
+// chainMiddlewares wraps a handler in router middlewares and then in route ones, the first router middleware is the outermost
+func chainMiddlewares(handler MsgHandler, routerMiddlewares []Middleware, routeMiddlewares []Middleware) MsgHandler {
+	for i := len(routeMiddlewares) - 1; i >= 0; i-- {
+		handler = routeMiddlewares[i](handler)
+	}
+
+	for i := len(routerMiddlewares) - 1; i >= 0; i-- {
+		handler = routerMiddlewares[i](handler)
+	}
+
+	return handler
+}
+
+// Stop drains all subscriptions and waits until messages in progress are processed
+func (r *Router) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	subs := r.subs
+	r.subs = nil
+	r.mu.Unlock()
+
+	for _, s := range subs {
+		if err := s.sub.Drain(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			infralog.Error("can't drain subscription", zap.String("subject", s.sub.Subject), zap.Error(err))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for _, s := range subs {
+			<-s.closed
+		}
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Router) dispatch(route Route, handler MsgHandler, msg *nats.Msg) {
+	ctx := ExtractContext(context.WithValue(context.Background(), routeCtxKey{}, route), msg)
+
+	data, err := handler(ctx, msg)
+	if msg.Reply == "" {
+		return
+	}
+
+	reply := nats.NewMsg(msg.Reply)
+	if err != nil {
+		reply.Header.Set(HeaderError, err.Error())
+	} else {
+		reply.Data = data
+	}
+
+	if err = msg.RespondMsg(reply); err != nil {
+		infralog.ErrorCtx(ctx, "can't reply to nats message", zap.String("subject", msg.Subject), zap.Error(err))
+	}
+}
@@ -0,0 +1,174 @@
+package infranats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"go.uber.org/zap"
+)
+
+var routerMetrics struct {
+	HandledCounter    *prometheus.CounterVec
+	HandlerDuration   *prometheus.HistogramVec
+	HandlersInProcess *prometheus.GaugeVec
+}
+var routerMetricsOnce sync.Once
+
+func initRouterMetrics() {
+	routerMetricsOnce.Do(func() {
+		routerMetrics.HandledCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nats_handled_messages_counter",
+			Help: "The total number of handled messages",
+		}, []string{"connection", "subject", "queue", "status"})
+
+		routerMetrics.HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nats_handler_duration",
+			Help:    "The nats message handler duration",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"connection", "subject", "queue", "status"})
+
+		routerMetrics.HandlersInProcess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nats_handlers_in_process",
+			Help: "The number of messages that are currently being handled",
+		}, []string{"connection", "subject", "queue"})
+
+		prometheus.MustRegister(
+			routerMetrics.HandledCounter,
+			routerMetrics.HandlerDuration,
+			routerMetrics.HandlersInProcess,
+		)
+	})
+}
+
+// LoggingMiddleware logs failed handlers at error level and successful ones at debug level
+func LoggingMiddleware() Middleware {
+	return func(next MsgHandler) MsgHandler {
+		return func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+			start := time.Now()
+			data, err := next(ctx, msg)
+
+			fields := []zap.Field{
+				zap.String("subject", msg.Subject),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				infralog.ErrorCtx(ctx, "nats handler error", append(fields, zap.Error(err))...)
+			} else {
+				infralog.DebugCtx(ctx, "nats message handled", fields...)
+			}
+
+			return data, err
+		}
+	}
+}
+
+// MetricsMiddleware collects number, duration and concurrency of handled messages.
+// Messages are labelled by subscription subject pattern, not by message subject.
+func MetricsMiddleware() Middleware {
+	initRouterMetrics()
+
+	return func(next MsgHandler) MsgHandler {
+		return func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+			route, _ := RouteFromContext(ctx)
+
+			inProcess := routerMetrics.HandlersInProcess.WithLabelValues(route.Connection, route.Subject, route.Queue)
+			inProcess.Inc()
+			defer inProcess.Dec()
+
+			start := time.Now()
+			data, err := next(ctx, msg)
+
+			status := "success"
+			if err != nil {
+				status = "error"
+			}
+
+			routerMetrics.HandledCounter.WithLabelValues(route.Connection, route.Subject, route.Queue, status).Inc()
+			routerMetrics.HandlerDuration.WithLabelValues(route.Connection, route.Subject, route.Queue, status).Observe(time.Since(start).Seconds())
+
+			return data, err
+		}
+	}
+}
+
+// RecoveryMiddleware converts handler panics to errors
+func RecoveryMiddleware() Middleware {
+	return func(next MsgHandler) MsgHandler {
+		return func(ctx context.Context, msg *nats.Msg) (data []byte, err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					infralog.ErrorCtx(ctx, "nats handler panic",
+						zap.String("subject", msg.Subject),
+						zap.Any("panic", e),
+						zap.Stack("stack"))
+					err = fmt.Errorf("panic: %v", e)
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// TimeoutMiddleware cancels handler context after a given timeout.
+// Handlers are expected to respect context cancellation.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next MsgHandler) MsgHandler {
+		return func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Codec encodes and decodes message data
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// JSONCodec encodes message data as JSON
+var JSONCodec Codec = jsonCodec{}
+
+// TypedHandler processes a decoded message. The response is encoded as a reply for request/reply subjects.
+type TypedHandler[Req any, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+// Decode adapts a typed handler to MsgHandler decoding requests and encoding responses with a codec
+func Decode[Req any, Resp any](codec Codec, handler TypedHandler[Req, Resp]) MsgHandler {
+	return func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+		var req Req
+		if err := codec.Unmarshal(msg.Data, &req); err != nil {
+			return nil, errors.Wrap(err, "can't decode message")
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Reply == "" {
+			return nil, nil
+		}
+
+		data, err := codec.Marshal(resp)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't encode reply")
+		}
+
+		return data, nil
+	}
+}
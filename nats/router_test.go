@@ -0,0 +1,131 @@
+package infranats
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func Test_chainMiddlewares(t *testing.T) {
+	var calls []string
+
+	record := func(name string) Middleware {
+		return func(next MsgHandler) MsgHandler {
+			return func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	handler := chainMiddlewares(
+		func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+			calls = append(calls, "handler")
+			return nil, nil
+		},
+		[]Middleware{record("router1"), record("router2")},
+		[]Middleware{record("route1"), record("route2")},
+	)
+
+	if _, err := handler(context.Background(), nats.NewMsg("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"router1", "router2", "route1", "route2", "handler"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func Test_Router_StopWaitsForHandlers(t *testing.T) {
+	_, cont := runServer(t, "router_stop", nil)
+
+	router, err := cont.CreateRouter("router_stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished bool
+
+	err = router.Handle("test.stop", "", func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+		close(started)
+		<-release
+		finished = true
+
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cont.Get("router_stop").Publish("test.stop", nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- router.Stop(context.Background())
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("router is stopped while a handler is in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case err = <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("router is not stopped")
+	}
+
+	if !finished {
+		t.Error("router is stopped before the handler is finished")
+	}
+}
+
+func Test_Router_StopTimeout(t *testing.T) {
+	_, cont := runServer(t, "router_timeout", nil)
+
+	router, err := cont.CreateRouter("router_timeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	err = router.Handle("test.timeout", "", func(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+		close(started)
+		<-release
+
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cont.Get("router_timeout").Publish("test.timeout", nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err = router.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -1,7 +1,8 @@
 package infrapostgres
 
 import (
-	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,9 +12,20 @@ import (
 type ConnectionsConfig map[string]*ConnectionConfig
 
 type ConnectionConfig struct {
-	// Database address. "host:port"
+	// Database address. "host:port".
+	// Comma-separated list of "host:port" is allowed, hosts are tried in order according to TargetSessionAttrs
 	Address string `mapstructure:"address"`
 
+	// Addresses of streaming replicas. "host:port". Optional
+	Replicas []string `mapstructure:"replicas"`
+
+	// Replicas lagging behind the primary more than that are excluded from routing.
+	// Lag is not checked if not set
+	ReplicaMaxLag time.Duration `mapstructure:"replica_max_lag"`
+
+	// Interval of replicas health checks. Default is 5s
+	ReplicaCheckInterval time.Duration `mapstructure:"replica_check_interval"`
+
 	// Database credentials
 	Credentials Credentials `mapstructure:"credentials"`
 
@@ -29,10 +41,60 @@ type ConnectionConfig struct {
 	// Connection idle time. Connections that idle more than that period will be closed
 	MaxConnectionIdleTime time.Duration `mapstructure:"max_connection_idle_time"`
 
+	// Whether to also create a native pgx pool with the same limits, available via GetPool.
+	// Idle connections of the pool are limited only by MaxConnectionIdleTime
+	NativePool bool `mapstructure:"native_pool"`
+
 	// Whether to use simple protocol.
 	// Extended protocol uses prepared queries.
 	// prepared queries are not compatible with PGBouncer in any modes other than session.
 	PreferSimpleProtocol bool `mapstructure:"prefer_simple_protocol"`
+
+	// Query logging. Optional
+	QueryLog *QueryLoggingConfig `mapstructure:"query_log"`
+
+	// TLS config. Optional
+	TLS *TLSConfig `mapstructure:"tls"`
+
+	// Application name shown in pg_stat_activity. Optional
+	ApplicationName string `mapstructure:"application_name"`
+
+	// Maximum duration of a statement. Server default is used if not set
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+
+	// Schema search path. Server default is used if not set
+	SearchPath []string `mapstructure:"search_path"`
+
+	// Timeout of establishing a connection, rounded up to seconds. Unlimited if not set
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+
+	// Required session type of a host in Address:
+	// "any" (default), "read-write", "read-only", "primary", "standby" or "prefer-standby".
+	// Not applied to Replicas
+	TargetSessionAttrs string `mapstructure:"target_session_attrs"`
+}
+
+type TLSConfig struct {
+	// SSL mode: "disable", "allow", "prefer" (default), "require", "verify-ca" or "verify-full"
+	Mode string `mapstructure:"mode"`
+
+	// Path to root CA certificate file. Optional
+	CAFile string `mapstructure:"ca_file"`
+
+	// Paths to client certificate and key files. Optional
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+type QueryLoggingConfig struct {
+	// Whether to log all queries
+	All bool `mapstructure:"all"`
+
+	// Whether to log slow queries
+	Slow bool `mapstructure:"slow"`
+
+	// Queries that were executed longer than that time will appear in slow log
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
 }
 
 type Credentials struct {
@@ -42,17 +104,51 @@ type Credentials struct {
 }
 
 func (c *ConnectionConfig) PGXConnString() string {
-	opts := []string{
-		fmt.Sprintf("prefer_simple_protocol=%t", c.PreferSimpleProtocol),
+	return c.pgxConnString(c.Address)
+}
+
+func (c *ConnectionConfig) pgxConnString(address string) string {
+	params := url.Values{}
+	params.Set("prefer_simple_protocol", strconv.FormatBool(c.PreferSimpleProtocol))
+
+	if c.TLS != nil {
+		setParam(params, "sslmode", c.TLS.Mode)
+		setParam(params, "sslrootcert", c.TLS.CAFile)
+		setParam(params, "sslcert", c.TLS.CertFile)
+		setParam(params, "sslkey", c.TLS.KeyFile)
+	}
+
+	setParam(params, "application_name", c.ApplicationName)
+	setParam(params, "search_path", strings.Join(c.SearchPath, ","))
+
+	if c.StatementTimeout > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+
+	if c.ConnectTimeout > 0 {
+		seconds := (c.ConnectTimeout + time.Second - 1) / time.Second
+		params.Set("connect_timeout", strconv.FormatInt(int64(seconds), 10))
 	}
 
-	return fmt.Sprintf(
-		"postgres://%s:%s@%s/%s?%s",
-		c.Credentials.Username,
-		c.Credentials.Password,
-		c.Address,
-		c.Credentials.Database,
-		strings.Join(opts, "&"))
+	if address == c.Address {
+		setParam(params, "target_session_attrs", c.TargetSessionAttrs)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.Credentials.Username, c.Credentials.Password),
+		Host:     address,
+		Path:     "/" + c.Credentials.Database,
+		RawQuery: params.Encode(),
+	}
+
+	return u.String()
+}
+
+func setParam(params url.Values, key string, value string) {
+	if value != "" {
+		params.Set(key, value)
+	}
 }
 
 func (c *ConnectionsConfig) Validate() error {
@@ -82,6 +178,68 @@ func (c *ConnectionConfig) Validate() error {
 		return errors.Wrap(err, "credentials")
 	}
 
+	for i, replica := range c.Replicas {
+		if replica == "" {
+			return errors.Errorf("replicas[%d] address is empty", i)
+		}
+	}
+
+	if c.ReplicaMaxLag < 0 || c.ReplicaCheckInterval < 0 {
+		return errors.New("replica_max_lag and replica_check_interval must not be negative")
+	}
+
+	if c.QueryLog != nil {
+		if err := c.QueryLog.Validate(); err != nil {
+			return errors.Wrap(err, "query_log")
+		}
+	}
+
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			return errors.Wrap(err, "tls")
+		}
+	}
+
+	if c.StatementTimeout < 0 || c.ConnectTimeout < 0 {
+		return errors.New("statement_timeout and connect_timeout must not be negative")
+	}
+
+	switch c.TargetSessionAttrs {
+	case "", "any", "read-write", "read-only", "primary", "standby", "prefer-standby":
+	default:
+		return errors.Errorf("invalid target_session_attrs \"%s\"", c.TargetSessionAttrs)
+	}
+
+	return nil
+}
+
+func (c *TLSConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty config")
+	}
+
+	switch c.Mode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		return errors.Errorf("invalid mode \"%s\"", c.Mode)
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+
+	return nil
+}
+
+func (c *QueryLoggingConfig) Validate() error {
+	if c == nil {
+		return errors.New("empty config")
+	}
+
+	if c.Slow && c.SlowThreshold == 0 {
+		return errors.New("slow threshold must be greater than zero")
+	}
+
 	return nil
 }
 
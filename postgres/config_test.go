@@ -0,0 +1,66 @@
+package infrapostgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func Test_PGXConnString(t *testing.T) {
+	cfg := &ConnectionConfig{
+		Address: "db1:5432,db2:5433",
+		Credentials: Credentials{
+			Database: "app",
+			Username: "user@corp",
+			Password: "p@ss:w/rd?#%",
+		},
+		ApplicationName:    "my app",
+		StatementTimeout:   1500 * time.Millisecond,
+		SearchPath:         []string{"app", "public"},
+		ConnectTimeout:     1500 * time.Millisecond,
+		TargetSessionAttrs: "read-write",
+		TLS:                &TLSConfig{Mode: "disable"},
+	}
+
+	c, err := pgx.ParseConfig(cfg.PGXConnString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.User != cfg.Credentials.Username || c.Password != cfg.Credentials.Password || c.Database != "app" {
+		t.Errorf("invalid credentials: %s %s %s", c.User, c.Password, c.Database)
+	}
+
+	if c.Host != "db1" || c.Port != 5432 || len(c.Fallbacks) != 1 || c.Fallbacks[0].Host != "db2" || c.Fallbacks[0].Port != 5433 {
+		t.Errorf("invalid hosts: %s:%d %v", c.Host, c.Port, c.Fallbacks)
+	}
+
+	if c.ConnectTimeout != 2*time.Second {
+		t.Errorf("invalid connect timeout: %s", c.ConnectTimeout)
+	}
+
+	if c.ValidateConnect == nil {
+		t.Error("target_session_attrs is not applied")
+	}
+
+	want := map[string]string{
+		"application_name":  "my app",
+		"statement_timeout": "1500",
+		"search_path":       "app,public",
+	}
+	for key, value := range want {
+		if c.RuntimeParams[key] != value {
+			t.Errorf("runtime param %s = %q, want %q", key, c.RuntimeParams[key], value)
+		}
+	}
+
+	replica, err := pgx.ParseConfig(cfg.pgxConnString("replica:5432"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replica.ValidateConnect != nil {
+		t.Error("target_session_attrs is applied to a replica")
+	}
+}
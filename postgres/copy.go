@@ -0,0 +1,288 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/pkg/errors"
+)
+
+// RowSource streams rows to copy. Rows are read one by one, so a source may produce them lazily.
+// It's compatible with pgx.CopyFromSource.
+type RowSource interface {
+	// Next advances to the next row. It returns false when there are no more rows or an error occurred
+	Next() bool
+
+	// Values returns values of the current row
+	Values() ([]interface{}, error)
+
+	// Err returns an error occurred while reading rows
+	Err() error
+}
+
+// RowsFromSlice returns a source of in-memory rows
+func RowsFromSlice(rows [][]interface{}) RowSource {
+	return pgx.CopyFromRows(rows)
+}
+
+// RowsFromFunc returns a source of rows produced by next. next must return io.EOF after the last row.
+func RowsFromFunc(next func() ([]interface{}, error)) RowSource {
+	return &funcSource{next: next}
+}
+
+type funcSource struct {
+	next   func() ([]interface{}, error)
+	values []interface{}
+	err    error
+}
+
+func (s *funcSource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	s.values, s.err = s.next()
+	if errors.Is(s.err, io.EOF) {
+		s.err = nil
+		return false
+	}
+
+	return s.err == nil
+}
+
+func (s *funcSource) Values() ([]interface{}, error) {
+	return s.values, nil
+}
+
+func (s *funcSource) Err() error {
+	return s.err
+}
+
+// countingSource counts read rows and annotates row errors with a row number
+type countingSource struct {
+	RowSource
+	rows int64
+}
+
+func (s *countingSource) Next() bool {
+	if !s.RowSource.Next() {
+		return false
+	}
+	s.rows++
+
+	return true
+}
+
+func (s *countingSource) Values() ([]interface{}, error) {
+	values, err := s.RowSource.Values()
+	if err != nil {
+		return nil, errors.Wrapf(err, "row %d", s.rows)
+	}
+
+	return values, nil
+}
+
+func (s *countingSource) Err() error {
+	if err := s.RowSource.Err(); err != nil {
+		return errors.Wrapf(err, "after row %d", s.rows)
+	}
+
+	return nil
+}
+
+// CopyResult reports results of a bulk load
+type CopyResult struct {
+	// Number of rows read from the source
+	Read int64
+
+	// Number of rows copied. For upserts it's the number of rows copied into the temporary table
+	Copied int64
+
+	// Number of rows inserted or updated by an upsert
+	Affected int64
+}
+
+type UpsertOptions struct {
+	// Columns of a unique constraint to detect conflicts
+	ConflictColumns []string
+
+	// Columns updated on conflict. All copied columns except conflict ones are updated if not set
+	UpdateColumns []string
+
+	// Whether to keep existing rows on conflict
+	DoNothing bool
+}
+
+// CopyLoader bulk loads rows by the COPY protocol
+type CopyLoader struct {
+	db *sql.DB
+}
+
+// CreateCopyLoader creates a bulk loader of a connection by a connection name
+func (cont *Container) CreateCopyLoader(connectionName string) (*CopyLoader, error) {
+	db := cont.Get(connectionName)
+	if db == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	return &CopyLoader{db: db}, nil
+}
+
+// Copy loads rows into columns of a table. Table name may be schema-qualified.
+// Either all rows are loaded or none of them.
+func (l *CopyLoader) Copy(ctx context.Context, table string, columns []string, src RowSource) (*CopyResult, error) {
+	counter := &countingSource{RowSource: src}
+	result := &CopyResult{}
+
+	err := l.withConn(ctx, func(conn *pgx.Conn) error {
+		copied, err := conn.CopyFrom(ctx, tableIdentifier(table), columns, counter)
+		result.Copied = copied
+		return err
+	})
+	result.Read = counter.rows
+
+	return result, err
+}
+
+// Upsert loads rows into a temporary table by COPY and then moves them into a table by INSERT ... ON CONFLICT.
+// It's done in a single transaction, so either all rows are loaded or none of them.
+// Rows with the same conflict columns are deduplicated, the last one wins.
+func (l *CopyLoader) Upsert(
+	ctx context.Context,
+	table string,
+	columns []string,
+	src RowSource,
+	opts *UpsertOptions,
+) (*CopyResult, error) {
+	if opts == nil || len(opts.ConflictColumns) == 0 {
+		return nil, errors.New("conflict columns are mandatory")
+	}
+
+	counter := &countingSource{RowSource: src}
+	result := &CopyResult{}
+
+	err := l.withConn(ctx, func(conn *pgx.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return errors.Wrap(err, "begin")
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		target := tableIdentifier(table).Sanitize()
+		temp := pgx.Identifier{"infra_copy_upsert"}
+
+		if _, err = tx.Exec(ctx, tempTableQuery(target, temp.Sanitize(), columns)); err != nil {
+			return errors.Wrap(err, "create temp table")
+		}
+
+		if _, err = tx.Exec(ctx, `ALTER TABLE `+temp.Sanitize()+` ADD COLUMN `+copyRowColumn+` bigserial`); err != nil {
+			return errors.Wrap(err, "add row number column")
+		}
+
+		if result.Copied, err = tx.CopyFrom(ctx, temp, columns, counter); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, upsertQuery(target, temp.Sanitize(), columns, opts))
+		if err != nil {
+			return errors.Wrap(err, "upsert")
+		}
+		result.Affected = tag.RowsAffected()
+
+		return tx.Commit(ctx)
+	})
+	result.Read = counter.rows
+
+	return result, err
+}
+
+// withConn runs fn on an underlying pgx connection of the pool
+func (l *CopyLoader) withConn(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "get connection")
+	}
+	defer func() { _ = conn.Close() }()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.Errorf("unexpected driver connection %T", driverConn)
+		}
+
+		return fn(stdlibConn.Conn())
+	})
+}
+
+func upsertQuery(target string, temp string, columns []string, opts *UpsertOptions) string {
+	cols := quoteIdentifiers(columns)
+
+	var action string
+	if opts.DoNothing {
+		action = "DO NOTHING"
+	} else {
+		update := opts.UpdateColumns
+		if len(update) == 0 {
+			update = exceptColumns(columns, opts.ConflictColumns)
+		}
+
+		set := make([]string, 0, len(update))
+		for _, column := range update {
+			quoted := pgx.Identifier{column}.Sanitize()
+			set = append(set, quoted+" = EXCLUDED."+quoted)
+		}
+
+		action = "DO UPDATE SET " + strings.Join(set, ", ")
+		if len(set) == 0 {
+			action = "DO NOTHING"
+		}
+	}
+
+	// a row can't be affected twice by INSERT ... ON CONFLICT, so only the last copied row of a key is taken
+	conflict := quoteIdentifiers(opts.ConflictColumns)
+
+	return `INSERT INTO ` + target + ` (` + cols + `) SELECT DISTINCT ON (` + conflict + `) ` + cols + ` FROM ` + temp +
+		` ORDER BY ` + conflict + `, ` + copyRowColumn + ` DESC ON CONFLICT (` + conflict + `) ` + action
+}
+
+// copyRowColumn numbers rows of an upsert temporary table in the copy order
+const copyRowColumn = `"infra_copy_row"`
+
+// tempTableQuery creates a temporary table of the copied columns only,
+// so NOT NULL constraints of columns which aren't copied don't apply to it
+func tempTableQuery(target string, temp string, columns []string) string {
+	return `CREATE TEMP TABLE ` + temp + ` ON COMMIT DROP AS SELECT ` + quoteIdentifiers(columns) + ` FROM ` + target + ` WITH NO DATA`
+}
+
+func tableIdentifier(table string) pgx.Identifier {
+	return strings.Split(table, ".")
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, pgx.Identifier{name}.Sanitize())
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func exceptColumns(columns []string, except []string) []string {
+	skip := make(map[string]struct{}, len(except))
+	for _, column := range except {
+		skip[column] = struct{}{}
+	}
+
+	result := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if _, ok := skip[column]; !ok {
+			result = append(result, column)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,75 @@
+package infrapostgres
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_upsertQuery(t *testing.T) {
+	tests := []struct {
+		opts *UpsertOptions
+		want string
+	}{
+		{
+			&UpsertOptions{ConflictColumns: []string{"id"}},
+			`INSERT INTO "public"."users" ("id", "name", "age") SELECT DISTINCT ON ("id") "id", "name", "age" FROM "tmp" ORDER BY "id", "infra_copy_row" DESC ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "age" = EXCLUDED."age"`,
+		},
+		{
+			&UpsertOptions{ConflictColumns: []string{"id"}, UpdateColumns: []string{"age"}},
+			`INSERT INTO "public"."users" ("id", "name", "age") SELECT DISTINCT ON ("id") "id", "name", "age" FROM "tmp" ORDER BY "id", "infra_copy_row" DESC ON CONFLICT ("id") DO UPDATE SET "age" = EXCLUDED."age"`,
+		},
+		{
+			&UpsertOptions{ConflictColumns: []string{"id"}, DoNothing: true},
+			`INSERT INTO "public"."users" ("id", "name", "age") SELECT DISTINCT ON ("id") "id", "name", "age" FROM "tmp" ORDER BY "id", "infra_copy_row" DESC ON CONFLICT ("id") DO NOTHING`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := upsertQuery(`"public"."users"`, `"tmp"`, []string{"id", "name", "age"}, tt.opts)
+		if got != tt.want {
+			t.Errorf("upsertQuery() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func Test_tempTableQuery(t *testing.T) {
+	got := tempTableQuery(`"public"."users"`, `"tmp"`, []string{"id", "name"})
+	want := `CREATE TEMP TABLE "tmp" ON COMMIT DROP AS SELECT "id", "name" FROM "public"."users" WITH NO DATA`
+	if got != want {
+		t.Errorf("tempTableQuery() = %s, want %s", got, want)
+	}
+}
+
+func Test_RowsFromFunc(t *testing.T) {
+	n := 0
+	src := &countingSource{RowSource: RowsFromFunc(func() ([]interface{}, error) {
+		n++
+		switch {
+		case n <= 3:
+			return []interface{}{n}, nil
+		case n == 4:
+			return nil, io.EOF
+		default:
+			return nil, errors.New("read after EOF")
+		}
+	})}
+
+	for src.Next() {
+		if _, err := src.Values(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if src.Err() != nil || src.rows != 3 {
+		t.Errorf("rows = %d, err = %v", src.rows, src.Err())
+	}
+
+	failing := &countingSource{RowSource: RowsFromFunc(func() ([]interface{}, error) {
+		return nil, errors.New("broken")
+	})}
+	if failing.Next() || failing.Err() == nil {
+		t.Error("source error is not reported")
+	}
+}
@@ -0,0 +1,264 @@
+package infrajobqueue
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/migrate"
+	"github.com/pushwoosh/infra/postgres"
+)
+
+const (
+	defaultMaxAttempts       = 10
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultPollInterval      = time.Second
+	defaultBackoff           = time.Second
+	defaultMaxBackoff        = time.Hour
+
+	sqlStateUniqueViolation = "23505"
+)
+
+const (
+	StatePending = "pending"
+	StateRunning = "running"
+	StateDead    = "dead"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// ErrDuplicate is returned by Enqueue if a job with the same unique key is pending or running
+var ErrDuplicate = errors.New("job with the same unique key already exists")
+
+// Migrate creates or updates the jobs table of a named postgres connection.
+// Versions are tracked in a separate table, so it doesn't interfere with application migrations.
+func Migrate(ctx context.Context, cont *infrapostgres.Container, connectionName string) error {
+	m, err := inframigrate.NewPostgres(cont, connectionName, migrations, &inframigrate.Config{
+		Dir:   "migrations",
+		Table: "jobqueue_schema_migrations",
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Up(ctx)
+}
+
+type Config struct {
+	// Number of jobs processed concurrently by a worker. Default is 1
+	Workers int `mapstructure:"workers"`
+
+	// Interval of polling for new jobs when the queue is empty. Default is 1s
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+
+	// Time a claimed job is hidden from other workers. The job is claimed again if it isn't finished in time,
+	// so the handler's context is cancelled after that. Default is 5m
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout"`
+
+	// Default number of attempts of a job before it becomes dead. Default is 10
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// Delay before the first retry. It's doubled on each next retry. Default is 1s
+	Backoff time.Duration `mapstructure:"backoff"`
+
+	// Maximum delay between retries. Default is 1h
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.Workers < 0 || c.MaxAttempts < 0 {
+		return errors.New("workers and max_attempts must not be negative")
+	}
+
+	if c.PollInterval < 0 || c.VisibilityTimeout < 0 || c.Backoff < 0 || c.MaxBackoff < 0 {
+		return errors.New("durations must not be negative")
+	}
+
+	return nil
+}
+
+func (c *Config) withDefaults() *Config {
+	cfg := Config{}
+	if c != nil {
+		cfg = *c
+	}
+
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+
+	return &cfg
+}
+
+// backoff returns a delay before a retry of a job failed a given number of times
+func (c *Config) backoff(attempts int) time.Duration {
+	backoff := c.Backoff
+	for i := 1; i < attempts && backoff < c.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+
+	return backoff
+}
+
+// Job is a job to enqueue
+type Job struct {
+	Payload []byte
+
+	// Time the job becomes available. Now if not set
+	RunAt time.Time
+
+	// Jobs with higher priority are claimed first
+	Priority int
+
+	// Only one pending or running job with a unique key may exist in a queue. Optional
+	UniqueKey string
+
+	// Number of attempts before the job becomes dead. Queue default is used if not set
+	MaxAttempts int
+}
+
+// Queue is a named job queue in a postgres jobs table
+type Queue struct {
+	db   *sql.DB
+	name string
+	cfg  *Config
+}
+
+// New creates a queue of a named postgres connection. cfg may be nil
+func New(cont *infrapostgres.Container, connectionName string, queue string, cfg *Config) (*Queue, error) {
+	db := cont.Get(connectionName)
+	if db == nil {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		db:   db,
+		name: queue,
+		cfg:  cfg.withDefaults(),
+	}, nil
+}
+
+// Enqueue adds a job to the queue and returns its id
+func (q *Queue) Enqueue(ctx context.Context, job *Job) (int64, error) {
+	return q.enqueue(ctx, q.db, job)
+}
+
+// EnqueueTx adds a job to the queue in a transaction, so the job is visible only if the transaction is committed
+func (q *Queue) EnqueueTx(ctx context.Context, tx *sql.Tx, job *Job) (int64, error) {
+	return q.enqueue(ctx, tx, job)
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (q *Queue) enqueue(ctx context.Context, db queryRower, job *Job) (int64, error) {
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = q.cfg.MaxAttempts
+	}
+
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	var uniqueKey *string
+	if job.UniqueKey != "" {
+		uniqueKey = &job.UniqueKey
+	}
+
+	// nil is sent as NULL, and the payload column is NOT NULL
+	payload := job.Payload
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	var id int64
+	err := db.QueryRowContext(ctx, `INSERT INTO jobqueue_jobs (queue, payload, priority, unique_key, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, now()))
+		RETURNING id`,
+		q.name, payload, job.Priority, uniqueKey, maxAttempts, runAt,
+	).Scan(&id)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == sqlStateUniqueViolation {
+		return 0, ErrDuplicate
+	}
+
+	return id, err
+}
+
+// Depth returns number of jobs in the queue by state
+func (q *Queue) Depth(ctx context.Context) (map[string]int64, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT state, count(*) FROM jobqueue_jobs WHERE queue = $1 GROUP BY state`, q.name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	depth := map[string]int64{
+		StatePending: 0,
+		StateRunning: 0,
+		StateDead:    0,
+	}
+	for rows.Next() {
+		var (
+			state string
+			count int64
+		)
+		if err = rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		depth[state] = count
+	}
+
+	return depth, rows.Err()
+}
+
+// Retry makes a dead job pending again with attempts reset
+func (q *Queue) Retry(ctx context.Context, id int64) error {
+	res, err := q.db.ExecContext(ctx, `UPDATE jobqueue_jobs
+		SET state = 'pending', attempts = 0, run_at = now(), locked_until = NULL, updated_at = now()
+		WHERE id = $1 AND queue = $2 AND state = 'dead'`, id, q.name)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.Errorf("dead job %d not found", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package infrajobqueue
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/pushwoosh/infra/internal/fakesql"
+)
+
+func Test_Config_backoff(t *testing.T) {
+	cfg := (&Config{Backoff: time.Second, MaxBackoff: 5 * time.Second}).withDefaults()
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := cfg.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func Test_migrations(t *testing.T) {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) == 0 {
+		t.Error("no migrations embedded")
+	}
+}
+
+func Test_Queue_Enqueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     *Job
+		payload []byte
+	}{
+		{name: "payload", job: &Job{Payload: []byte("payload")}, payload: []byte("payload")},
+		{name: "no payload", job: &Job{}, payload: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakesql.DB{
+				Query: func(string, []driver.Value) (driver.Rows, error) {
+					return fakesql.NewRows([]string{"id"}, []driver.Value{int64(1)}), nil
+				},
+			}
+			q := &Queue{db: sql.OpenDB(f), name: "test", cfg: (&Config{MaxAttempts: 5}).withDefaults()}
+
+			id, err := q.Enqueue(context.Background(), tt.job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != 1 {
+				t.Errorf("id = %d, want 1", id)
+			}
+
+			args := f.Statements()[0].Args
+			// the payload column is NOT NULL
+			if payload, ok := args[1].([]byte); !ok || payload == nil || !bytes.Equal(payload, tt.payload) {
+				t.Errorf("payload = %#v, want %q", args[1], tt.payload)
+			}
+			if args[0] != "test" || args[3] != nil || args[4] != int64(5) || args[5] != nil {
+				t.Errorf("unexpected args %v", args)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS jobqueue_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	queue TEXT NOT NULL,
+	payload BYTEA NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	unique_key TEXT,
+	state TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	locked_until TIMESTAMPTZ,
+	last_error TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- a unique key is reserved while its job is pending or running
+CREATE UNIQUE INDEX IF NOT EXISTS jobqueue_jobs_unique_key_idx
+	ON jobqueue_jobs (queue, unique_key)
+	WHERE unique_key IS NOT NULL AND state <> 'dead';
+
+CREATE INDEX IF NOT EXISTS jobqueue_jobs_claim_idx
+	ON jobqueue_jobs (queue, priority DESC, run_at)
+	WHERE state IN ('pending', 'running');
@@ -0,0 +1,333 @@
+package infrajobqueue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+const (
+	depthUpdateInterval = 10 * time.Second
+	finishTimeout       = 10 * time.Second
+)
+
+var metrics struct {
+	Jobs          *prometheus.GaugeVec
+	ProcessedJobs *prometheus.CounterVec
+	JobLatency    *prometheus.HistogramVec
+	JobDuration   *prometheus.HistogramVec
+	JobsInProcess *prometheus.GaugeVec
+}
+var metricsOnce sync.Once
+
+func initMetrics() {
+	metricsOnce.Do(func() {
+		metrics.Jobs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "jobqueue_jobs",
+			Help: "The number of jobs in a queue by state",
+		}, []string{"queue", "state"})
+
+		metrics.ProcessedJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jobqueue_processed_jobs_counter",
+			Help: "The total number of processed jobs",
+		}, []string{"queue", "status"})
+
+		metrics.JobLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jobqueue_job_latency",
+			Help:    "The time between a job becomes available and it's claimed",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+		}, []string{"queue"})
+
+		metrics.JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jobqueue_job_duration",
+			Help:    "The job handler duration",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"queue", "status"})
+
+		metrics.JobsInProcess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "jobqueue_jobs_in_process",
+			Help: "The number of jobs that are currently being processed",
+		}, []string{"queue"})
+
+		prometheus.MustRegister(
+			metrics.Jobs,
+			metrics.ProcessedJobs,
+			metrics.JobLatency,
+			metrics.JobDuration,
+			metrics.JobsInProcess,
+		)
+	})
+}
+
+// ClaimedJob is a job claimed by a worker
+type ClaimedJob struct {
+	ID        int64
+	Payload   []byte
+	Priority  int
+	UniqueKey string
+	RunAt     time.Time
+
+	// Attempt is the number of the current attempt starting from 1
+	Attempt     int
+	MaxAttempts int
+}
+
+// Handler processes a job. The job is deleted if the handler returns nil.
+// Otherwise it's retried with backoff until it runs out of attempts and becomes dead.
+// The context is cancelled when the visibility timeout of the job expires.
+type Handler func(ctx context.Context, job *ClaimedJob) error
+
+// Worker claims jobs of a queue and runs a handler on them
+type Worker struct {
+	queue   *Queue
+	handler Handler
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	_ infraoperator.Starter = (*Worker)(nil)
+	_ infraoperator.Stopper = (*Worker)(nil)
+)
+
+// CreateWorker creates a worker of the queue
+func (q *Queue) CreateWorker(handler Handler) *Worker {
+	initMetrics()
+
+	return &Worker{
+		queue:   q,
+		handler: handler,
+	}
+}
+
+// Start starts processing jobs in background
+func (w *Worker) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	for i := 0; i < w.queue.cfg.Workers; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.run(ctx)
+		}()
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.updateDepth(ctx)
+	}()
+
+	return nil
+}
+
+// Stop stops claiming jobs and waits until jobs in progress are processed.
+// Jobs not finished before ctx is done are claimed again after their visibility timeout.
+func (w *Worker) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	w.cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) run(ctx context.Context) {
+	for {
+		job, err := w.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			infralog.Error("can't claim job", zap.String("queue", w.queue.name), zap.Error(err))
+		}
+
+		if job == nil {
+			select {
+			case <-time.After(w.queue.cfg.PollInterval):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		w.process(job)
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// claim locks the next available job: a pending one or a running one with expired visibility timeout
+func (w *Worker) claim(ctx context.Context) (*ClaimedJob, error) {
+	q := w.queue
+
+	var (
+		job       ClaimedJob
+		uniqueKey sql.NullString
+		reclaimed bool
+	)
+	err := q.db.QueryRowContext(ctx, `UPDATE jobqueue_jobs j
+		SET state = 'running', attempts = j.attempts + 1, locked_until = now() + $2 * interval '1 millisecond', updated_at = now()
+		FROM (
+			SELECT id, state FROM jobqueue_jobs
+			WHERE queue = $1 AND (
+				(state = 'pending' AND run_at <= now()) OR
+				(state = 'running' AND locked_until < now())
+			)
+			ORDER BY priority DESC, run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		) claimed
+		WHERE j.id = claimed.id
+		RETURNING j.id, j.payload, j.priority, j.unique_key, j.run_at, j.attempts, j.max_attempts, claimed.state = 'running'`,
+		q.name, q.cfg.VisibilityTimeout.Milliseconds(),
+	).Scan(&job.ID, &job.Payload, &job.Priority, &uniqueKey, &job.RunAt, &job.Attempt, &job.MaxAttempts, &reclaimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job.UniqueKey = uniqueKey.String
+
+	// a reclaimed job became available when its lock expired rather than at run_at, so its latency is unknown
+	if !reclaimed {
+		metrics.JobLatency.WithLabelValues(q.name).Observe(time.Since(job.RunAt).Seconds())
+	}
+
+	return &job, nil
+}
+
+func (w *Worker) process(job *ClaimedJob) {
+	q := w.queue
+	fields := []zap.Field{
+		zap.String("queue", q.name),
+		zap.Int64("job_id", job.ID),
+		zap.Int("attempt", job.Attempt),
+	}
+
+	// a job reclaimed after its last attempt timed out isn't run again
+	if job.Attempt > job.MaxAttempts {
+		w.finish(job, errors.New("visibility timeout expired on the last attempt"), fields)
+		return
+	}
+
+	inProcess := metrics.JobsInProcess.WithLabelValues(q.name)
+	inProcess.Inc()
+	defer inProcess.Dec()
+
+	// handlers are not interrupted by Stop, only by the visibility timeout
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.VisibilityTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := w.handle(ctx, job)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.JobDuration.WithLabelValues(q.name, status).Observe(time.Since(start).Seconds())
+
+	w.finish(job, err, fields)
+}
+
+func (w *Worker) handle(ctx context.Context, job *ClaimedJob) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("panic: %v", e)
+		}
+	}()
+
+	return w.handler(ctx, job)
+}
+
+// finish deletes a succeeded job or schedules a retry of a failed one.
+// Attempts guard against finishing a job that was reclaimed by another worker.
+func (w *Worker) finish(job *ClaimedJob, jobErr error, fields []zap.Field) {
+	q := w.queue
+
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+
+	var (
+		res    sql.Result
+		err    error
+		status string
+	)
+	switch {
+	case jobErr == nil:
+		status = "success"
+		res, err = q.db.ExecContext(ctx, `DELETE FROM jobqueue_jobs WHERE id = $1 AND attempts = $2`, job.ID, job.Attempt)
+
+	case job.Attempt >= job.MaxAttempts:
+		status = StateDead
+		infralog.Error("job is dead", append(fields, zap.Error(jobErr))...)
+		res, err = q.db.ExecContext(ctx, `UPDATE jobqueue_jobs
+			SET state = 'dead', locked_until = NULL, last_error = $3, updated_at = now()
+			WHERE id = $1 AND attempts = $2`, job.ID, job.Attempt, jobErr.Error())
+
+	default:
+		status = "retry"
+		infralog.Warn("job failed", append(fields, zap.Error(jobErr))...)
+		res, err = q.db.ExecContext(ctx, `UPDATE jobqueue_jobs
+			SET state = 'pending', locked_until = NULL, last_error = $3, updated_at = now(),
+				run_at = now() + $4 * interval '1 millisecond'
+			WHERE id = $1 AND attempts = $2`, job.ID, job.Attempt, jobErr.Error(), q.cfg.backoff(job.Attempt).Milliseconds())
+	}
+
+	metrics.ProcessedJobs.WithLabelValues(q.name, status).Inc()
+
+	if err != nil {
+		infralog.Error("can't finish job", append(fields, zap.Error(err))...)
+		return
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		infralog.Warn("job was reclaimed before it finished", fields...)
+	}
+}
+
+func (w *Worker) updateDepth(ctx context.Context) {
+	ticker := time.NewTicker(depthUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		depth, err := w.queue.Depth(ctx)
+		if err == nil {
+			for state, count := range depth {
+				metrics.Jobs.WithLabelValues(w.queue.name, state).Set(float64(count))
+			}
+		} else if ctx.Err() == nil {
+			infralog.Error("can't get queue depth", zap.String("queue", w.queue.name), zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package infrajobqueue
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/pushwoosh/infra/internal/fakesql"
+)
+
+// claimColumns are columns returned by the claim query
+var claimColumns = []string{"id", "payload", "priority", "unique_key", "run_at", "attempts", "max_attempts", "?column?"}
+
+func newTestWorker(f *fakesql.DB, handler Handler) *Worker {
+	q := &Queue{
+		db:   sql.OpenDB(f),
+		name: "test",
+		cfg:  (&Config{Backoff: time.Second}).withDefaults(),
+	}
+
+	return q.CreateWorker(handler)
+}
+
+func latencySamples(t *testing.T) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := metrics.JobLatency.WithLabelValues("test").(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func Test_Worker_claim(t *testing.T) {
+	tests := []struct {
+		name          string
+		reclaimed     bool
+		latencyWanted bool
+	}{
+		{name: "pending job", reclaimed: false, latencyWanted: true},
+		{name: "reclaimed job", reclaimed: true, latencyWanted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runAt := time.Now().Add(-time.Minute)
+			f := &fakesql.DB{
+				Query: func(string, []driver.Value) (driver.Rows, error) {
+					row := []driver.Value{int64(1), []byte("payload"), int64(5), nil, runAt, int64(2), int64(3), tt.reclaimed}
+					return fakesql.NewRows(claimColumns, row), nil
+				},
+			}
+			w := newTestWorker(f, nil)
+
+			before := latencySamples(t)
+
+			job, err := w.claim(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.ID != 1 || string(job.Payload) != "payload" || job.Priority != 5 || job.UniqueKey != "" ||
+				!job.RunAt.Equal(runAt) || job.Attempt != 2 || job.MaxAttempts != 3 {
+				t.Errorf("unexpected job %+v", job)
+			}
+
+			if args := f.Statements()[0].Args; args[0] != "test" || args[1] != w.queue.cfg.VisibilityTimeout.Milliseconds() {
+				t.Errorf("unexpected claim args %v", args)
+			}
+
+			if observed := latencySamples(t) > before; observed != tt.latencyWanted {
+				t.Errorf("latency observed: %v, want %v", observed, tt.latencyWanted)
+			}
+		})
+	}
+}
+
+func Test_Worker_claim_noJobs(t *testing.T) {
+	w := newTestWorker(&fakesql.DB{}, nil)
+
+	job, err := w.claim(context.Background())
+	if job != nil || err != nil {
+		t.Errorf("claim() = %v, %v, want no job", job, err)
+	}
+}
+
+func Test_Worker_process(t *testing.T) {
+	tests := []struct {
+		name        string
+		attempt     int
+		handlerErr  error
+		wantHandled bool
+		wantQuery   string
+		wantArgs    []driver.Value
+	}{
+		{
+			name:        "success",
+			attempt:     1,
+			wantHandled: true,
+			wantQuery:   "DELETE FROM jobqueue_jobs",
+			wantArgs:    []driver.Value{int64(7), int64(1)},
+		},
+		{
+			name:        "retry",
+			attempt:     2,
+			handlerErr:  errors.New("failed"),
+			wantHandled: true,
+			wantQuery:   "SET state = 'pending'",
+			wantArgs:    []driver.Value{int64(7), int64(2), "failed", (2 * time.Second).Milliseconds()},
+		},
+		{
+			name:        "dead",
+			attempt:     3,
+			handlerErr:  errors.New("failed"),
+			wantHandled: true,
+			wantQuery:   "SET state = 'dead'",
+			wantArgs:    []driver.Value{int64(7), int64(3), "failed"},
+		},
+		{
+			name:        "timed out last attempt",
+			attempt:     4,
+			wantHandled: false,
+			wantQuery:   "SET state = 'dead'",
+			wantArgs:    []driver.Value{int64(7), int64(4), "visibility timeout expired on the last attempt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakesql.DB{
+				Exec: func(string, []driver.Value) (driver.Result, error) {
+					return driver.RowsAffected(1), nil
+				},
+			}
+
+			handled := false
+			w := newTestWorker(f, func(ctx context.Context, job *ClaimedJob) error {
+				handled = true
+				return tt.handlerErr
+			})
+
+			w.process(&ClaimedJob{ID: 7, Attempt: tt.attempt, MaxAttempts: 3})
+
+			if handled != tt.wantHandled {
+				t.Errorf("handled: %v, want %v", handled, tt.wantHandled)
+			}
+
+			statements := f.Statements()
+			if len(statements) != 1 {
+				t.Fatalf("expected 1 statement, got %d", len(statements))
+			}
+
+			exec := statements[0]
+			if !strings.Contains(exec.Query, tt.wantQuery) {
+				t.Errorf("unexpected query %s", exec.Query)
+			}
+
+			// the attempts guard prevents finishing a job reclaimed by another worker
+			if !strings.Contains(exec.Query, "attempts = $2") {
+				t.Errorf("query has no attempts guard: %s", exec.Query)
+			}
+
+			if len(exec.Args) != len(tt.wantArgs) {
+				t.Fatalf("args = %v, want %v", exec.Args, tt.wantArgs)
+			}
+			for i := range tt.wantArgs {
+				if exec.Args[i] != tt.wantArgs[i] {
+					t.Errorf("arg %d = %v, want %v", i, exec.Args[i], tt.wantArgs[i])
+				}
+			}
+		})
+	}
+}
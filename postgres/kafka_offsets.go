@@ -0,0 +1,90 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// KafkaOffsetStore keeps kafka consumer offsets in a postgres table.
+// Offsets are committed inside the same transaction as processing results,
+// so each message takes effect exactly once.
+// It implements infrakafka.OffsetStore.
+type KafkaOffsetStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewKafkaOffsetStore creates a new offset store on a given table. Table name may be schema-qualified.
+func NewKafkaOffsetStore(db *sql.DB, table string) *KafkaOffsetStore {
+	return &KafkaOffsetStore{
+		db:    db,
+		table: pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+	}
+}
+
+// CreateTable creates offsets table if it doesn't exist
+func (s *KafkaOffsetStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+		consumer_group TEXT NOT NULL,
+		topic TEXT NOT NULL,
+		partition INTEGER NOT NULL,
+		next_offset BIGINT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (consumer_group, topic, partition)
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "create offsets table")
+	}
+
+	return nil
+}
+
+// LoadOffsets returns offsets of the next messages to read by partition
+func (s *KafkaOffsetStore) LoadOffsets(ctx context.Context, group string, topic string) (map[int]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT partition, next_offset FROM `+s.table+` WHERE consumer_group = $1 AND topic = $2`,
+		group, topic)
+	if err != nil {
+		return nil, errors.Wrap(err, "select offsets")
+	}
+	defer func() { _ = rows.Close() }()
+
+	ret := make(map[int]int64)
+	for rows.Next() {
+		var (
+			partition int
+			offset    int64
+		)
+
+		if err = rows.Scan(&partition, &offset); err != nil {
+			return nil, errors.Wrap(err, "scan offset")
+		}
+
+		ret[partition] = offset
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "select offsets")
+	}
+
+	return ret, nil
+}
+
+// CommitTx stores offset of a processed message inside a given transaction.
+// The consumer continues from the next message after restart.
+func (s *KafkaOffsetStore) CommitTx(ctx context.Context, tx *sql.Tx, group string, topic string, partition int, offset int64) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO `+s.table+` (consumer_group, topic, partition, next_offset)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (consumer_group, topic, partition)
+		DO UPDATE SET next_offset = EXCLUDED.next_offset, updated_at = now()`,
+		group, topic, partition, offset+1)
+	if err != nil {
+		return errors.Wrap(err, "store offset")
+	}
+
+	return nil
+}
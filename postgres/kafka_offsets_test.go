@@ -0,0 +1,134 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/pushwoosh/infra/internal/fakesql"
+	"github.com/pushwoosh/infra/kafka"
+)
+
+var _ infrakafka.OffsetStore = (*KafkaOffsetStore)(nil)
+
+// offsetsTable emulates the offsets table, upserts are applied on commit
+type offsetsTable struct {
+	offsets map[offsetKey]int64
+	pending map[offsetKey]int64
+}
+
+type offsetKey struct {
+	group     string
+	topic     string
+	partition int64
+}
+
+func newFakeOffsetsDB() *fakesql.DB {
+	table := &offsetsTable{offsets: make(map[offsetKey]int64)}
+
+	return &fakesql.DB{
+		Begin: func(driver.TxOptions) error {
+			table.pending = make(map[offsetKey]int64)
+			return nil
+		},
+		Commit: func() error {
+			for key, offset := range table.pending {
+				table.offsets[key] = offset
+			}
+			table.pending = nil
+			return nil
+		},
+		Rollback: func() error {
+			table.pending = nil
+			return nil
+		},
+		Exec: func(query string, args []driver.Value) (driver.Result, error) {
+			if !strings.HasPrefix(query, "INSERT INTO") {
+				return nil, errors.Errorf("unexpected query %s", query)
+			}
+
+			if table.pending == nil {
+				return nil, errors.New("offset is stored outside a transaction")
+			}
+
+			key := offsetKey{group: args[0].(string), topic: args[1].(string), partition: args[2].(int64)}
+			table.pending[key] = args[3].(int64)
+
+			return driver.RowsAffected(1), nil
+		},
+		Query: func(query string, args []driver.Value) (driver.Rows, error) {
+			if !strings.HasPrefix(query, "SELECT partition, next_offset") {
+				return nil, errors.Errorf("unexpected query %s", query)
+			}
+
+			var values [][]driver.Value
+			for key, offset := range table.offsets {
+				if key.group == args[0] && key.topic == args[1] {
+					values = append(values, []driver.Value{key.partition, offset})
+				}
+			}
+			sort.Slice(values, func(i, j int) bool { return values[i][0].(int64) < values[j][0].(int64) })
+
+			return fakesql.NewRows([]string{"partition", "next_offset"}, values...), nil
+		},
+	}
+}
+
+func Test_KafkaOffsetStore(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(newFakeOffsetsDB())
+	defer func() { _ = db.Close() }()
+
+	store := NewKafkaOffsetStore(db, "public.kafka_offsets")
+	if store.table != `"public"."kafka_offsets"` {
+		t.Errorf("unexpected table %s", store.table)
+	}
+
+	commit := func(partition int, offset int64, rollback bool) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = store.CommitTx(ctx, tx, "group", "events", partition, offset); err != nil {
+			t.Fatal(err)
+		}
+
+		if rollback {
+			err = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commit(0, 10, false)
+	commit(0, 41, false)
+	commit(1, 7, false)
+	commit(1, 8, true)
+
+	offsets, err := store.LoadOffsets(ctx, "group", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the consumer resumes at the message after the last processed one
+	if len(offsets) != 2 || offsets[0] != 42 || offsets[1] != 8 {
+		t.Errorf("unexpected offsets %v", offsets)
+	}
+
+	offsets, err = store.LoadOffsets(ctx, "other", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(offsets) != 0 {
+		t.Errorf("unexpected offsets of another group %v", offsets)
+	}
+}
@@ -0,0 +1,314 @@
+package infrapostgres
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"github.com/pushwoosh/infra/operator"
+	"go.uber.org/zap"
+)
+
+const (
+	listenerReconnectDelay    = 100 * time.Millisecond
+	listenerMaxReconnectDelay = 10 * time.Second
+	listenerBufferSize        = 64
+)
+
+var listenerMetrics struct {
+	NotificationsCounter *prometheus.CounterVec
+	ReconnectsCounter    *prometheus.CounterVec
+	Connected            *prometheus.GaugeVec
+}
+var listenerMetricsOnce sync.Once
+
+func initListenerMetrics() {
+	listenerMetricsOnce.Do(func() {
+		listenerMetrics.NotificationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "postgres_notifications_counter",
+			Help: "The total number of received notifications",
+		}, []string{"connection", "channel"})
+
+		listenerMetrics.ReconnectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "postgres_listener_reconnects_counter",
+			Help: "The total number of listener reconnects",
+		}, []string{"connection"})
+
+		listenerMetrics.Connected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "postgres_listener_connected",
+			Help: "Whether a listener is connected",
+		}, []string{"connection"})
+
+		prometheus.MustRegister(
+			listenerMetrics.NotificationsCounter,
+			listenerMetrics.ReconnectsCounter,
+			listenerMetrics.Connected,
+		)
+	})
+}
+
+// Notification is a message sent by NOTIFY or pg_notify
+type Notification struct {
+	Channel string
+	Payload string
+
+	// PID of the notifying backend
+	PID uint32
+}
+
+// NotificationHandler processes a notification
+type NotificationHandler func(ctx context.Context, n *Notification)
+
+// listenerConn is a connection notifications are received on
+type listenerConn interface {
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+// Listener receives notifications of channels on a dedicated connection outside of the connection pool.
+// Notifications sent while the connection is lost are not delivered,
+// so consumers should resync their state if it matters.
+type Listener struct {
+	name     string
+	channels []string
+	handler  NotificationHandler
+
+	// dial connects and listens channels
+	dial func(ctx context.Context) (listenerConn, error)
+
+	notifications chan *Notification
+	connected     atomic.Bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	_ infraoperator.Starter = (*Listener)(nil)
+	_ infraoperator.Stopper = (*Listener)(nil)
+	_ infraoperator.Checker = (*Listener)(nil)
+)
+
+// CreateListener creates a listener of channels by a connection name.
+// Notifications are passed to the handler. If the handler is nil, they are delivered to Notifications channel.
+func (cont *Container) CreateListener(connectionName string, channels []string, handler NotificationHandler) (*Listener, error) {
+	cont.mu.RLock()
+	cfg, ok := cont.cfg[connectionName]
+	cont.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("invalid connection name: \"%s\"", connectionName)
+	}
+
+	if len(channels) == 0 {
+		return nil, errors.New("channels are mandatory")
+	}
+
+	connConfig, err := pgx.ParseConfig(cfg.PGXConnString())
+	if err != nil {
+		return nil, errors.Wrap(err, "pgx.ParseConfig")
+	}
+
+	l := newListener(connectionName, channels, handler)
+	l.dial = func(ctx context.Context) (listenerConn, error) {
+		conn, err := listen(ctx, connConfig, channels)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn, nil
+	}
+
+	return l, nil
+}
+
+func newListener(name string, channels []string, handler NotificationHandler) *Listener {
+	initListenerMetrics()
+
+	l := &Listener{
+		name:     name,
+		channels: channels,
+		handler:  handler,
+	}
+
+	if handler == nil {
+		l.notifications = make(chan *Notification, listenerBufferSize)
+	}
+
+	return l
+}
+
+// Notifications returns a channel of notifications if the listener is created without a handler.
+// The channel is closed once the listener is stopped.
+func (l *Listener) Notifications() <-chan *Notification {
+	return l.notifications
+}
+
+// Start connects and listens channels, then receives notifications in background
+func (l *Listener) Start(ctx context.Context) error {
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	l.setConnected(true)
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		if l.notifications != nil {
+			// closed by the sender, so a notification is never sent to the closed channel
+			defer close(l.notifications)
+		}
+
+		l.run(runCtx, conn)
+	}()
+
+	return nil
+}
+
+// Stop stops receiving notifications and closes the connection
+func (l *Listener) Stop(ctx context.Context) error {
+	if l.cancel == nil {
+		return nil
+	}
+	l.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check returns an error if the listener is not connected
+func (l *Listener) Check(_ context.Context) error {
+	if !l.connected.Load() {
+		return errors.Errorf("postgres listener \"%s\" is not connected", l.name)
+	}
+
+	return nil
+}
+
+// listen connects and listens channels
+func listen(ctx context.Context, cfg *pgx.ConnConfig, channels []string) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect")
+	}
+
+	for _, channel := range channels {
+		if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			_ = conn.Close(context.Background())
+			return nil, errors.Wrapf(err, "listen \"%s\"", channel)
+		}
+	}
+
+	return conn, nil
+}
+
+func (l *Listener) setConnected(connected bool) {
+	l.connected.Store(connected)
+
+	var value float64
+	if connected {
+		value = 1
+	}
+	listenerMetrics.Connected.WithLabelValues(l.name).Set(value)
+}
+
+func (l *Listener) run(ctx context.Context, conn listenerConn) {
+	defer func() {
+		l.setConnected(false)
+		if conn != nil {
+			_ = conn.Close(context.Background())
+		}
+	}()
+
+	for {
+		err := l.receive(ctx, conn)
+		if ctx.Err() != nil {
+			return
+		}
+
+		infralog.Error("postgres listener connection lost", zap.String("connection", l.name), zap.Error(err))
+		l.setConnected(false)
+		_ = conn.Close(context.Background())
+
+		if conn = l.reconnect(ctx); conn == nil {
+			return
+		}
+	}
+}
+
+// receive delivers notifications until the connection fails or ctx is done
+func (l *Listener) receive(ctx context.Context, conn listenerConn) error {
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		listenerMetrics.NotificationsCounter.WithLabelValues(l.name, n.Channel).Inc()
+
+		notification := &Notification{
+			Channel: n.Channel,
+			Payload: n.Payload,
+			PID:     n.PID,
+		}
+
+		if l.handler != nil {
+			l.handler(ctx, notification)
+			continue
+		}
+
+		select {
+		case l.notifications <- notification:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reconnect connects and listens channels again with backoff. Returns nil if ctx is done
+func (l *Listener) reconnect(ctx context.Context) listenerConn {
+	delay := listenerReconnectDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+
+		listenerMetrics.ReconnectsCounter.WithLabelValues(l.name).Inc()
+
+		conn, err := l.dial(ctx)
+		if err == nil {
+			l.setConnected(true)
+			infralog.Info("postgres listener reconnected", zap.String("connection", l.name))
+			return conn
+		}
+
+		infralog.Error("can't reconnect postgres listener", zap.String("connection", l.name), zap.Error(err))
+
+		delay *= 2
+		if delay > listenerMaxReconnectDelay {
+			delay = listenerMaxReconnectDelay
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package infrapostgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+)
+
+// fakeListenerConn delivers notifications sent to its channel and fails when the channel is closed
+type fakeListenerConn struct {
+	notifications chan *pgconn.Notification
+	closed        chan struct{}
+}
+
+func newFakeListenerConn() *fakeListenerConn {
+	return &fakeListenerConn{
+		notifications: make(chan *pgconn.Notification),
+		closed:        make(chan struct{}),
+	}
+}
+
+func (c *fakeListenerConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case n, ok := <-c.notifications:
+		if !ok {
+			return nil, errors.New("connection lost")
+		}
+		return n, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakeListenerConn) Close(context.Context) error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+
+	return nil
+}
+
+func Test_Listener_Notifications(t *testing.T) {
+	conn := newFakeListenerConn()
+
+	l := newListener("test_listener", []string{"events"}, nil)
+	l.dial = func(ctx context.Context) (listenerConn, error) {
+		return conn, nil
+	}
+
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Check(context.Background()); err != nil {
+		t.Errorf("started listener is not connected: %v", err)
+	}
+
+	conn.notifications <- &pgconn.Notification{PID: 1, Channel: "events", Payload: "hello"}
+
+	n := <-l.Notifications()
+	if n.Channel != "events" || n.Payload != "hello" || n.PID != 1 {
+		t.Errorf("unexpected notification %+v", n)
+	}
+
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-l.Notifications(); ok {
+		t.Error("notifications channel is not closed after stop")
+	}
+
+	select {
+	case <-conn.closed:
+	default:
+		t.Error("connection is not closed after stop")
+	}
+
+	if err := l.Check(context.Background()); err == nil {
+		t.Error("stopped listener is connected")
+	}
+}
+
+func Test_Listener_Handler(t *testing.T) {
+	conn := newFakeListenerConn()
+	received := make(chan *Notification, 1)
+
+	l := newListener("test_listener", []string{"events"}, func(ctx context.Context, n *Notification) {
+		received <- n
+	})
+	l.dial = func(ctx context.Context) (listenerConn, error) {
+		return conn, nil
+	}
+
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Stop(context.Background()) }()
+
+	if l.Notifications() != nil {
+		t.Error("notifications channel is created for a listener with a handler")
+	}
+
+	conn.notifications <- &pgconn.Notification{Channel: "events", Payload: "hello"}
+
+	if n := <-received; n.Payload != "hello" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
+
+func Test_Listener_Reconnect(t *testing.T) {
+	conns := make(chan *fakeListenerConn, 2)
+	first, second := newFakeListenerConn(), newFakeListenerConn()
+	conns <- first
+	conns <- second
+
+	l := newListener("test_listener", []string{"events"}, nil)
+	l.dial = func(ctx context.Context) (listenerConn, error) {
+		select {
+		case conn := <-conns:
+			return conn, nil
+		default:
+			return nil, errors.New("no more connections")
+		}
+	}
+
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Stop(context.Background()) }()
+
+	// the first connection is lost
+	close(first.notifications)
+
+	select {
+	case second.notifications <- &pgconn.Notification{Channel: "events", Payload: "after reconnect"}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener is not reconnected")
+	}
+
+	if n := <-l.Notifications(); n.Payload != "after reconnect" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+
+	select {
+	case <-first.closed:
+	default:
+		t.Error("lost connection is not closed")
+	}
+}
+
+func Test_Listener_StartError(t *testing.T) {
+	l := newListener("test_listener", []string{"events"}, nil)
+	l.dial = func(ctx context.Context) (listenerConn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	if err := l.Start(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+
+	if err := l.Stop(context.Background()); err != nil {
+		t.Errorf("stop of a not started listener failed: %v", err)
+	}
+}
+
+func Test_CreateListener(t *testing.T) {
+	cont := NewContainer()
+
+	if _, err := cont.CreateListener("missing", []string{"events"}, nil); err == nil {
+		t.Error("expected an error of an unknown connection")
+	}
+
+	cont.cfg["test"] = ConnectionConfig{Address: "localhost:5432", Credentials: Credentials{Database: "db", Username: "user"}}
+
+	if _, err := cont.CreateListener("test", nil, nil); err == nil {
+		t.Error("expected an error without channels")
+	}
+
+	if _, err := cont.CreateListener("test", []string{"events"}, nil); err != nil {
+		t.Error(err)
+	}
+}
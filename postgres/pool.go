@@ -0,0 +1,177 @@
+package infrapostgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	poolStatsNamespace = "pgxpool"
+	poolStatsSubsystem = "connections"
+)
+
+// ConnectPool creates a new named native pgx pool.
+// Unlike Connect, it doesn't create a database/sql connection, so Get returns nil for the name.
+func (cont *Container) ConnectPool(name string, cfg *ConnectionConfig) error {
+	pool, err := openPool(name, cfg)
+	if err != nil {
+		return err
+	}
+
+	cont.mu.Lock()
+	old := cont.swapPool(name, pool)
+	cont.cfg[name] = *cfg
+	cont.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	return nil
+}
+
+// openPool opens a native pgx pool to the primary address and checks it
+func openPool(name string, cfg *ConnectionConfig) (*pgxpool.Pool, error) {
+	c, err := pgxpool.ParseConfig(cfg.PGXConnString())
+	if err != nil {
+		return nil, errors.Wrap(err, "pgxpool.ParseConfig")
+	}
+
+	if cfg.MaxConnections > 0 {
+		c.MaxConns = int32(cfg.MaxConnections)
+	}
+	if cfg.MaxConnectionLifetime > 0 {
+		c.MaxConnLifetime = cfg.MaxConnectionLifetime
+	}
+	if cfg.MaxConnectionIdleTime > 0 {
+		c.MaxConnIdleTime = cfg.MaxConnectionIdleTime
+	}
+
+	c.ConnConfig.Logger = newQueryTracer(name, cfg.QueryLog)
+	c.ConnConfig.LogLevel = pgx.LogLevelInfo
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), c)
+	if err != nil {
+		return nil, errors.Wrap(err, "pgxpool.ConnectConfig")
+	}
+
+	if err = pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, errors.Wrap(err, "pool.Ping")
+	}
+
+	return pool, nil
+}
+
+// swapPool stores a pool and registers its stats collector replacing the previous ones.
+// A nil pool removes the previous one. The previous pool is returned to be closed after cont.mu is unlocked,
+// since closing waits until all acquired connections are released. cont.mu must be locked.
+func (cont *Container) swapPool(name string, pool *pgxpool.Pool) *pgxpool.Pool {
+	old := cont.pools[name]
+	if collector := cont.poolCollectors[name]; collector != nil {
+		prometheus.Unregister(collector)
+		delete(cont.poolCollectors, name)
+	}
+
+	if pool == nil {
+		delete(cont.pools, name)
+		return old
+	}
+
+	collector := NewPoolStatsCollector(name, pool)
+	prometheus.MustRegister(collector)
+
+	cont.pools[name] = pool
+	cont.poolCollectors[name] = collector
+
+	return old
+}
+
+// GetPool gets native pgx pool from a container
+func (cont *Container) GetPool(name string) *pgxpool.Pool {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	return cont.pools[name]
+}
+
+// GetPoolCollector gets native pool metrics collector from a container
+func (cont *Container) GetPoolCollector(name string) *PoolStatsCollector {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	return cont.poolCollectors[name]
+}
+
+// PoolStatsCollector exports stats of a native pgx pool.
+// Metrics mirror the ones of sqlstats with "pgxpool" namespace, so dashboards may be shared.
+type PoolStatsCollector struct {
+	pool *pgxpool.Pool
+
+	maxOpenDesc           *prometheus.Desc
+	openDesc              *prometheus.Desc
+	inUseDesc             *prometheus.Desc
+	idleDesc              *prometheus.Desc
+	constructingDesc      *prometheus.Desc
+	waitedForDesc         *prometheus.Desc
+	blockedSecondsDesc    *prometheus.Desc
+	canceledAcquireDesc   *prometheus.Desc
+	closedMaxIdleDesc     *prometheus.Desc
+	closedMaxLifetimeDesc *prometheus.Desc
+}
+
+// NewPoolStatsCollector creates a new PoolStatsCollector
+func NewPoolStatsCollector(dbName string, pool *pgxpool.Pool) *PoolStatsCollector {
+	labels := prometheus.Labels{"db_name": dbName}
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(poolStatsNamespace, poolStatsSubsystem, name), help, nil, labels)
+	}
+
+	return &PoolStatsCollector{
+		pool:                  pool,
+		maxOpenDesc:           desc("max_open", "Maximum number of open connections to the database."),
+		openDesc:              desc("open", "The number of established connections both in use and idle."),
+		inUseDesc:             desc("in_use", "The number of connections currently in use."),
+		idleDesc:              desc("idle", "The number of idle connections."),
+		constructingDesc:      desc("constructing", "The number of connections being established."),
+		waitedForDesc:         desc("waited_for", "The total number of connections waited for."),
+		blockedSecondsDesc:    desc("blocked_seconds", "The total time spent acquiring connections."),
+		canceledAcquireDesc:   desc("canceled_acquire", "The total number of acquires cancelled by a context."),
+		closedMaxIdleDesc:     desc("closed_max_idle", "The total number of connections closed due to MaxConnIdleTime."),
+		closedMaxLifetimeDesc: desc("closed_max_lifetime", "The total number of connections closed due to MaxConnLifetime."),
+	}
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *PoolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpenDesc
+	ch <- c.openDesc
+	ch <- c.inUseDesc
+	ch <- c.idleDesc
+	ch <- c.constructingDesc
+	ch <- c.waitedForDesc
+	ch <- c.blockedSecondsDesc
+	ch <- c.canceledAcquireDesc
+	ch <- c.closedMaxIdleDesc
+	ch <- c.closedMaxLifetimeDesc
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *PoolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.maxOpenDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.openDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.inUseDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingDesc, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.waitedForDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.blockedSecondsDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquireDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.closedMaxIdleDesc, prometheus.CounterValue, float64(stat.MaxIdleDestroyCount()))
+	ch <- prometheus.MustNewConstMetric(c.closedMaxLifetimeDesc, prometheus.CounterValue, float64(stat.MaxLifetimeDestroyCount()))
+}
@@ -0,0 +1,76 @@
+package infrapostgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// lazyPool creates a pool which doesn't connect until a connection is acquired
+func lazyPool(t *testing.T, maxConns int32) *pgxpool.Pool {
+	t.Helper()
+
+	cfg, err := pgxpool.ParseConfig("postgres://user@localhost:5432/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxConns = maxConns
+	cfg.LazyConnect = true
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+func Test_Container_swapPool(t *testing.T) {
+	cont := NewContainer()
+	first, second := lazyPool(t, 1), lazyPool(t, 1)
+
+	cont.mu.Lock()
+	defer cont.mu.Unlock()
+
+	if old := cont.swapPool("swap", first); old != nil {
+		t.Error("no previous pool is expected")
+	}
+
+	if old := cont.swapPool("swap", second); old != first {
+		t.Error("the first pool is expected to be returned for closing")
+	}
+	if cont.pools["swap"] != second || cont.poolCollectors["swap"].pool != second {
+		t.Error("the second pool is not stored")
+	}
+
+	// reconnecting without a native pool removes it
+	if old := cont.swapPool("swap", nil); old != second {
+		t.Error("the second pool is expected to be returned for closing")
+	}
+	if cont.pools["swap"] != nil || cont.poolCollectors["swap"] != nil {
+		t.Error("the pool is not removed")
+	}
+}
+
+func Test_PoolStatsCollector(t *testing.T) {
+	pool := lazyPool(t, 7)
+
+	collector := NewPoolStatsCollector("test", pool)
+
+	if n := testutil.CollectAndCount(collector); n != 10 {
+		t.Errorf("collected %d metrics, want 10", n)
+	}
+
+	expected := `
+# HELP pgxpool_connections_max_open Maximum number of open connections to the database.
+# TYPE pgxpool_connections_max_open gauge
+pgxpool_connections_max_open{db_name="test"} 7
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "pgxpool_connections_max_open"); err != nil {
+		t.Error(err)
+	}
+}
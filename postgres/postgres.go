@@ -2,11 +2,13 @@ package infrapostgres
 
 import (
 	"database/sql"
+	"fmt"
 
 	"sync"
 
 	"github.com/dlmiddlecote/sqlstats"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -19,6 +21,10 @@ type Container struct {
 	cfg        map[string]ConnectionConfig
 	conns      map[string]*sql.DB
 	collectors map[string]*sqlstats.StatsCollector
+	routers    map[string]*Router
+
+	pools          map[string]*pgxpool.Pool
+	poolCollectors map[string]*PoolStatsCollector
 }
 
 func NewContainer() *Container {
@@ -27,25 +33,109 @@ func NewContainer() *Container {
 		cfg:        make(map[string]ConnectionConfig),
 		conns:      make(map[string]*sql.DB),
 		collectors: make(map[string]*sqlstats.StatsCollector),
+		routers:    make(map[string]*Router),
+
+		pools:          make(map[string]*pgxpool.Pool),
+		poolCollectors: make(map[string]*PoolStatsCollector),
 	}
 }
 
-// Connect creates a new named postgres connection
+// Connect creates a new named postgres connection.
+// If replicas are configured, a router of the connection is available via GetRouter.
+// If NativePool is set, a native pgx pool of the connection is available via GetPool.
 func (cont *Container) Connect(name string, cfg *ConnectionConfig) error {
-	c, err := pgx.ParseConfig(cfg.PGXConnString())
+	conn, err := openDB(name, cfg.Address, cfg)
 	if err != nil {
-		return errors.Wrap(err, "pgx.ParseConfig")
+		return err
 	}
 
-	connStr := stdlib.RegisterConnConfig(c)
-	conn, err := sql.Open("pgx", connStr)
+	err = conn.Ping()
 	if err != nil {
-		return errors.Wrapf(err, "sql.Open")
+		return errors.Wrapf(err, "conn.Ping")
 	}
 
-	err = conn.Ping()
+	replicas := make([]*replica, 0, len(cfg.Replicas))
+	for i, address := range cfg.Replicas {
+		replicaName := fmt.Sprintf("%s_replica%d", name, i)
+		db, err := openDB(replicaName, address, cfg)
+		if err != nil {
+			_ = closeReplicas(replicas)
+			_ = conn.Close()
+			return errors.Wrapf(err, "replica \"%s\"", address)
+		}
+
+		replicas = append(replicas, &replica{name: replicaName, address: address, db: db})
+	}
+
+	var pool *pgxpool.Pool
+	if cfg.NativePool {
+		pool, err = openPool(name, cfg)
+		if err != nil {
+			_ = closeReplicas(replicas)
+			_ = conn.Close()
+			return errors.Wrap(err, "native pool")
+		}
+	}
+
+	var router *Router
+	if len(replicas) > 0 {
+		router = newRouter(name, conn, replicas, cfg)
+		router.start()
+	}
+
+	cont.mu.Lock()
+	old := cont.routers[name]
+	if router != nil {
+		cont.routers[name] = router
+	} else {
+		delete(cont.routers, name)
+	}
+
+	if old != nil {
+		for _, r := range old.replicas {
+			cont.unregisterCollector(r.name)
+		}
+	}
+
+	cont.registerCollector(name, conn)
+	for _, r := range replicas {
+		cont.registerCollector(r.name, r.db)
+	}
+
+	// the previous pool is removed if the connection is not a native pool anymore
+	oldPool := cont.swapPool(name, pool)
+
+	cont.conns[name] = conn
+	cont.cfg[name] = *cfg
+	cont.mu.Unlock()
+
+	// the previous router and pool are closed outside the lock,
+	// they wait for running replica checks and acquired connections
+	if old != nil {
+		old.stop()
+		_ = closeReplicas(old.replicas)
+	}
+	if oldPool != nil {
+		oldPool.Close()
+	}
+
+	return nil
+}
+
+// openDB opens a connection pool to a given address
+func openDB(name string, address string, cfg *ConnectionConfig) (*sql.DB, error) {
+	c, err := pgx.ParseConfig(cfg.pgxConnString(address))
 	if err != nil {
-		return errors.Wrapf(err, "conn.Ping")
+		return nil, errors.Wrap(err, "pgx.ParseConfig")
+	}
+
+	c.Logger = newQueryTracer(name, cfg.QueryLog)
+	c.LogLevel = pgx.LogLevelInfo
+
+	connStr := stdlib.RegisterConnConfig(c)
+	conn, err := sql.Open("pgx", connStr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "sql.Open")
 	}
 
 	conn.SetMaxOpenConns(cfg.MaxConnections)
@@ -53,20 +143,27 @@ func (cont *Container) Connect(name string, cfg *ConnectionConfig) error {
 	conn.SetConnMaxIdleTime(cfg.MaxConnectionIdleTime)
 	conn.SetConnMaxLifetime(cfg.MaxConnectionLifetime)
 
-	if collector := cont.GetCollector(name); collector != nil {
+	return conn, nil
+}
+
+// registerCollector registers pool stats collector of a connection replacing the previous one.
+// cont.mu must be locked.
+func (cont *Container) registerCollector(name string, conn *sql.DB) {
+	if collector := cont.collectors[name]; collector != nil {
 		prometheus.Unregister(collector)
 	}
+
 	collector := sqlstats.NewStatsCollector(name, conn)
 	prometheus.MustRegister(collector)
-
-	cont.mu.Lock()
-	defer cont.mu.Unlock()
-
-	cont.conns[name] = conn
-	cont.cfg[name] = *cfg
 	cont.collectors[name] = collector
+}
 
-	return nil
+// unregisterCollector unregisters pool stats collector of a connection. cont.mu must be locked.
+func (cont *Container) unregisterCollector(name string) {
+	if collector := cont.collectors[name]; collector != nil {
+		prometheus.Unregister(collector)
+		delete(cont.collectors, name)
+	}
 }
 
 // Get gets connection from a container
@@ -84,3 +181,47 @@ func (cont *Container) GetCollector(name string) *sqlstats.StatsCollector {
 
 	return cont.collectors[name]
 }
+
+// GetRouter gets a primary/replicas router of a connection from a container.
+// A connection without replicas gets a router that always returns the primary.
+func (cont *Container) GetRouter(name string) *Router {
+	cont.mu.RLock()
+	defer cont.mu.RUnlock()
+
+	if router, ok := cont.routers[name]; ok {
+		return router
+	}
+
+	conn, ok := cont.conns[name]
+	if !ok {
+		return nil
+	}
+
+	return &Router{name: name, primary: conn}
+}
+
+// Close stops replicas health checks and closes all connections and pools of a container
+func (cont *Container) Close() error {
+	cont.mu.Lock()
+	defer cont.mu.Unlock()
+
+	var err error
+	for _, router := range cont.routers {
+		router.stop()
+		if closeErr := closeReplicas(router.replicas); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	for _, conn := range cont.conns {
+		if closeErr := conn.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	for _, pool := range cont.pools {
+		pool.Close()
+	}
+
+	return err
+}
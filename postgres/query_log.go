@@ -0,0 +1,249 @@
+package infrapostgres
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"go.uber.org/zap"
+)
+
+var metrics struct {
+	QueryDurationHistogram *prometheus.HistogramVec
+}
+var metricsOnce sync.Once
+
+func initMetrics() {
+	metricsOnce.Do(func() {
+		metrics.QueryDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "postgres_query_duration",
+			Help:    "The postgres query duration",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, math.Inf(1)},
+		}, []string{"connection", "query", "command", "status"})
+
+		prometheus.MustRegister(metrics.QueryDurationHistogram)
+	})
+}
+
+type queryNameCtxKey struct{}
+
+// WithQueryName puts a query name into the context. It is used as a metrics label and a log field
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameCtxKey{}, name)
+}
+
+// QueryNameFromContext returns a query name put into the context by WithQueryName
+func QueryNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(queryNameCtxKey{}).(string)
+	return name
+}
+
+// queryTracer instruments queries through the pgx logger.
+// pgx reports queries at info level and failed ones at error level.
+type queryTracer struct {
+	name string
+	cfg  *QueryLoggingConfig
+}
+
+var _ pgx.Logger = (*queryTracer)(nil)
+
+func newQueryTracer(name string, cfg *QueryLoggingConfig) *queryTracer {
+	initMetrics()
+
+	return &queryTracer{
+		name: name,
+		cfg:  cfg,
+	}
+}
+
+func (t *queryTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	// pgx messages of executed statements
+	switch msg {
+	case "Query", "Exec", "SendBatch":
+	default:
+		return
+	}
+
+	duration, _ := data["time"].(time.Duration)
+	queryName := QueryNameFromContext(ctx)
+
+	status := "success"
+	if level == pgx.LogLevelError {
+		status = "error"
+	}
+
+	metrics.QueryDurationHistogram.WithLabelValues(t.name, queryName, msg, status).Observe(duration.Seconds())
+
+	if t.cfg == nil {
+		return
+	}
+
+	slow := t.cfg.Slow && duration > t.cfg.SlowThreshold
+	if !t.cfg.All && !slow {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("connection", t.name),
+		zap.String("command", msg),
+		zap.Duration("duration", duration),
+	}
+	if queryName != "" {
+		fields = append(fields, zap.String("query_name", queryName))
+	}
+	if sql, ok := data["sql"].(string); ok {
+		fields = append(fields, zap.String("query", SanitizeSQL(sql)))
+	}
+	if batchLen, ok := data["batchLen"].(int); ok {
+		fields = append(fields, zap.Int("batch_len", batchLen))
+	}
+
+	switch {
+	case status == "error":
+		err, _ := data["err"].(error)
+		infralog.ErrorCtx(ctx, "query failed", append(fields, zap.Error(err))...)
+	case slow:
+		infralog.WarnCtx(ctx, "slow query", fields...)
+	default:
+		infralog.DebugCtx(ctx, "query succeeded", fields...)
+	}
+}
+
+// SanitizeSQL replaces literals of a statement with "?", drops comments and collapses whitespaces.
+// Positional parameters like $1 are kept.
+func SanitizeSQL(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+
+	space := false
+	writeSpace := func() {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			space = true
+
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+			space = true
+
+		case c == '\'':
+			i = skipQuoted(sql, i+1)
+			writeSpace()
+			b.WriteByte('?')
+
+		case c == '$' && i+1 < len(sql) && isDigit(sql[i+1]):
+			writeSpace()
+			b.WriteByte('$')
+			i++
+			for i < len(sql) && isDigit(sql[i]) {
+				b.WriteByte(sql[i])
+				i++
+			}
+
+		case c == '$':
+			// dollar-quoted string: $tag$ ... $tag$
+			end := strings.IndexByte(sql[i+1:], '$')
+			tag := ""
+			if end >= 0 {
+				tag = sql[i : i+end+2]
+			}
+			if tag == "" || !isTag(tag[1:len(tag)-1]) {
+				writeSpace()
+				b.WriteByte(c)
+				i++
+				break
+			}
+
+			closing := strings.Index(sql[i+len(tag):], tag)
+			if closing < 0 {
+				i = len(sql)
+			} else {
+				i += len(tag) + closing + len(tag)
+			}
+			writeSpace()
+			b.WriteByte('?')
+
+		case isDigit(c) && !isIdentifierEnd(b.String(), space):
+			for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.' || sql[i] == 'e' || sql[i] == 'E') {
+				i++
+			}
+			writeSpace()
+			b.WriteByte('?')
+
+		default:
+			writeSpace()
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// skipQuoted returns an index after the end of a single-quoted literal starting at i
+func skipQuoted(sql string, i int) int {
+	for i < len(sql) {
+		if sql[i] == '\'' {
+			if i+1 < len(sql) && sql[i+1] == '\'' {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isTag(tag string) bool {
+	for i := 0; i < len(tag); i++ {
+		if !isIdentifierChar(tag[i]) || (i == 0 && isDigit(tag[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isIdentifierEnd returns true if a digit following written output continues an identifier
+func isIdentifierEnd(written string, space bool) bool {
+	if space || written == "" {
+		return false
+	}
+
+	return isIdentifierChar(written[len(written)-1])
+}
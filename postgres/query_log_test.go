@@ -0,0 +1,23 @@
+package infrapostgres
+
+import "testing"
+
+func Test_SanitizeSQL(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT 1", "SELECT ?"},
+		{"select * from t1 where id = $1", "select * from t1 where id = $1"},
+		{"SELECT *\n  FROM users\n WHERE name = 'o''brien' AND age > 42.5", "SELECT * FROM users WHERE name = ? AND age > ?"},
+		{"SELECT 1 -- comment\nFROM t /* block */ WHERE x IN (1, 2)", "SELECT ? FROM t WHERE x IN (?, ?)"},
+		{"SELECT $body$ it's text $body$, $$x$$", "SELECT ?, ?"},
+		{"INSERT INTO col2 (a_1) VALUES ('x')", "INSERT INTO col2 (a_1) VALUES (?)"},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeSQL(tt.sql); got != tt.want {
+			t.Errorf("SanitizeSQL(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"go.uber.org/zap"
+)
+
+const defaultReplicaCheckInterval = 5 * time.Second
+
+// replicaLagQuery returns replication lag in seconds.
+// A replica that has replayed everything it received is not lagging even if the primary is idle,
+// unless its WAL receiver is not running: received LSN doesn't advance then, so the time since
+// the last replayed transaction is used, and a replica that has never replayed one is infinitely behind.
+// pg_stat_wal_receiver has a row only while the receiver is running, and it's visible to any role.
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver)
+		THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8, 'Infinity'::float8)
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::float8, 0)
+END`
+
+var replicaMetrics struct {
+	Healthy *prometheus.GaugeVec
+	Lag     *prometheus.GaugeVec
+}
+var replicaMetricsOnce sync.Once
+
+func initReplicaMetrics() {
+	replicaMetricsOnce.Do(func() {
+		replicaMetrics.Healthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "postgres_replica_healthy",
+			Help: "Whether a replica is available for routing",
+		}, []string{"connection", "replica"})
+
+		replicaMetrics.Lag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "postgres_replica_lag_seconds",
+			Help: "The replication lag of a replica",
+		}, []string{"connection", "replica"})
+
+		prometheus.MustRegister(replicaMetrics.Healthy, replicaMetrics.Lag)
+	})
+}
+
+// lagSource returns replication lag of a replica in seconds
+type lagSource func(ctx context.Context, db *sql.DB) (float64, error)
+
+func queryReplicaLag(ctx context.Context, db *sql.DB) (float64, error) {
+	var lag float64
+	err := db.QueryRowContext(ctx, replicaLagQuery).Scan(&lag)
+
+	return lag, err
+}
+
+type replica struct {
+	name    string
+	address string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// Router routes queries to the primary or to healthy replicas of a connection
+type Router struct {
+	name     string
+	primary  *sql.DB
+	replicas []*replica
+
+	maxLag        time.Duration
+	checkInterval time.Duration
+	lag           lagSource
+
+	next   atomic.Uint64
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newRouter(name string, primary *sql.DB, replicas []*replica, cfg *ConnectionConfig) *Router {
+	initReplicaMetrics()
+
+	checkInterval := cfg.ReplicaCheckInterval
+	if checkInterval <= 0 {
+		checkInterval = defaultReplicaCheckInterval
+	}
+
+	return &Router{
+		name:          name,
+		primary:       primary,
+		replicas:      replicas,
+		maxLag:        cfg.ReplicaMaxLag,
+		checkInterval: checkInterval,
+		lag:           queryReplicaLag,
+	}
+}
+
+// Primary returns the primary connection
+func (r *Router) Primary() *sql.DB {
+	return r.primary
+}
+
+// Replica returns a healthy replica connection balancing in round-robin.
+// The primary is returned if no replica is available.
+func (r *Router) Replica() *sql.DB {
+	n := uint64(len(r.replicas))
+	if n == 0 {
+		return r.primary
+	}
+
+	start := r.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if rep := r.replicas[(start+i)%n]; rep.healthy.Load() {
+			return rep.db
+		}
+	}
+
+	return r.primary
+}
+
+// start checks replicas synchronously once and then periodically in background
+func (r *Router) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.checkReplicas(ctx)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.checkReplicas(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *Router) stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+func (r *Router) checkReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, rep := range r.replicas {
+		wg.Add(1)
+		go func(rep *replica) {
+			defer wg.Done()
+			r.checkReplica(ctx, rep)
+		}(rep)
+	}
+	wg.Wait()
+}
+
+func (r *Router) checkReplica(ctx context.Context, rep *replica) {
+	checkCtx, cancel := context.WithTimeout(ctx, r.checkInterval)
+	defer cancel()
+
+	lag, err := r.lag(checkCtx, rep.db)
+	if ctx.Err() != nil {
+		// the router is stopped
+		return
+	}
+
+	healthy := err == nil
+	if healthy && r.maxLag > 0 && lag > r.maxLag.Seconds() {
+		healthy = false
+	}
+
+	if err == nil {
+		replicaMetrics.Lag.WithLabelValues(r.name, rep.address).Set(lag)
+	}
+
+	var healthyValue float64
+	if healthy {
+		healthyValue = 1
+	}
+	replicaMetrics.Healthy.WithLabelValues(r.name, rep.address).Set(healthyValue)
+
+	if rep.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("connection", r.name),
+		zap.String("replica", rep.address),
+		zap.Float64("lag", lag),
+	}
+	if healthy {
+		infralog.Info("postgres replica is available", fields...)
+	} else {
+		infralog.Warn("postgres replica is unavailable", append(fields, zap.Error(err))...)
+	}
+}
+
+func closeReplicas(replicas []*replica) error {
+	var err error
+	for _, rep := range replicas {
+		if closeErr := rep.db.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
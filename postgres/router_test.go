@@ -0,0 +1,83 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func Test_Router_Replica(t *testing.T) {
+	primary := &sql.DB{}
+	first, second := &sql.DB{}, &sql.DB{}
+
+	tests := []struct {
+		name   string
+		lags   map[*sql.DB]float64
+		failed map[*sql.DB]bool
+		want   []*sql.DB
+	}{
+		{
+			name: "round-robin",
+			lags: map[*sql.DB]float64{first: 0, second: 0},
+			want: []*sql.DB{second, first, second, first},
+		},
+		{
+			name: "lagging replica is excluded",
+			lags: map[*sql.DB]float64{first: 0, second: 30},
+			want: []*sql.DB{first, first, first},
+		},
+		{
+			name: "disconnected replica is excluded",
+			lags: map[*sql.DB]float64{first: math.Inf(1), second: 0},
+			want: []*sql.DB{second, second},
+		},
+		{
+			name:   "failed replica is excluded",
+			lags:   map[*sql.DB]float64{first: 0, second: 0},
+			failed: map[*sql.DB]bool{first: true},
+			want:   []*sql.DB{second, second, second},
+		},
+		{
+			name:   "primary fallback",
+			lags:   map[*sql.DB]float64{first: 30, second: 0},
+			failed: map[*sql.DB]bool{second: true},
+			want:   []*sql.DB{primary, primary},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter("test", primary, []*replica{
+				{name: "test_replica0", address: "first:5432", db: first},
+				{name: "test_replica1", address: "second:5432", db: second},
+			}, &ConnectionConfig{ReplicaMaxLag: 10 * time.Second})
+
+			router.lag = func(_ context.Context, db *sql.DB) (float64, error) {
+				if tt.failed[db] {
+					return 0, errors.New("connection refused")
+				}
+				return tt.lags[db], nil
+			}
+			router.checkReplicas(context.Background())
+
+			for i, want := range tt.want {
+				if got := router.Replica(); got != want {
+					t.Errorf("call %d: got %p, want %p", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_Router_Replica_withoutReplicas(t *testing.T) {
+	primary := &sql.DB{}
+	router := &Router{name: "test", primary: primary}
+
+	if router.Replica() != primary {
+		t.Error("primary is expected without replicas")
+	}
+}
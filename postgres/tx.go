@@ -0,0 +1,170 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pushwoosh/infra/log"
+	"go.uber.org/zap"
+)
+
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+
+	defaultTxMaxRetries = 5
+	defaultTxBackoff    = 10 * time.Millisecond
+	defaultTxMaxBackoff = time.Second
+)
+
+var txMetrics struct {
+	RetriesCounter *prometheus.CounterVec
+}
+var txMetricsOnce sync.Once
+
+func initTxMetrics() {
+	txMetricsOnce.Do(func() {
+		txMetrics.RetriesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "postgres_tx_retries_counter",
+			Help: "The total number of retried transactions",
+		}, []string{"query", "code"})
+
+		prometheus.MustRegister(txMetrics.RetriesCounter)
+	})
+}
+
+type TxOptions struct {
+	// Transaction isolation level. Database default is used if not set
+	Isolation sql.IsolationLevel
+
+	// Whether the transaction is read-only
+	ReadOnly bool
+
+	// Maximum number of retries on serialization failures and deadlocks. Default is 5, -1 disables retries
+	MaxRetries int
+
+	// Delay before the first retry. It's doubled on each next retry. Default is 10ms
+	Backoff time.Duration
+
+	// Maximum delay between retries. Default is 1s
+	MaxBackoff time.Duration
+}
+
+// WithTx runs fn in a transaction. The transaction is committed if fn returns nil and rolled back otherwise.
+// A panic in fn rolls back the transaction and is propagated.
+// The whole transaction is retried with backoff on serialization failures and deadlocks,
+// so fn must not have side effects outside the transaction. opts may be nil.
+// Retries are labelled by the query name from the context, see WithQueryName.
+func WithTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(*sql.Tx) error) error {
+	initTxMetrics()
+
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultTxMaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil {
+			return nil
+		}
+
+		code, retryable := retryableTxError(err)
+		if !retryable || attempt >= maxRetries {
+			return err
+		}
+
+		txMetrics.RetriesCounter.WithLabelValues(QueryNameFromContext(ctx), code).Inc()
+		infralog.DebugCtx(ctx, "retrying postgres transaction", zap.Int("attempt", attempt+1), zap.Error(err))
+
+		select {
+		case <-time.After(opts.backoff(attempt)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(*sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return errors.Wrap(err, "begin")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollbackTx(ctx, tx)
+			panic(p)
+		}
+
+		if err != nil {
+			rollbackTx(ctx, tx)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "commit")
+	}
+
+	return nil
+}
+
+func rollbackTx(ctx context.Context, tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		infralog.ErrorCtx(ctx, "can't rollback postgres transaction", zap.Error(err))
+	}
+}
+
+// retryableTxError returns SQLSTATE of an error if the transaction may succeed being retried
+func retryableTxError(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return "", false
+	}
+
+	switch pgErr.Code {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return pgErr.Code, true
+	default:
+		return "", false
+	}
+}
+
+// backoff returns a delay before a given retry attempt starting from 0
+func (o *TxOptions) backoff(attempt int) time.Duration {
+	backoff := o.Backoff
+	if backoff <= 0 {
+		backoff = defaultTxBackoff
+	}
+
+	maxBackoff := o.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultTxMaxBackoff
+	}
+
+	for i := 0; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1,195 @@
+package infrapostgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pushwoosh/infra/internal/fakesql"
+)
+
+func Test_retryableTxError(t *testing.T) {
+	tests := []struct {
+		err       error
+		code      string
+		retryable bool
+	}{
+		{errors.New("some error"), "", false},
+		{&pgconn.PgError{Code: "23505"}, "", false},
+		{&pgconn.PgError{Code: "40001"}, "40001", true},
+		{errors.Wrap(&pgconn.PgError{Code: "40P01"}, "commit"), "40P01", true},
+	}
+
+	for _, tt := range tests {
+		code, retryable := retryableTxError(tt.err)
+		if code != tt.code || retryable != tt.retryable {
+			t.Errorf("retryableTxError(%v) = %q, %t, want %q, %t", tt.err, code, retryable, tt.code, tt.retryable)
+		}
+	}
+}
+
+func Test_TxOptions_backoff(t *testing.T) {
+	opts := &TxOptions{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for attempt, w := range want {
+		if got := opts.backoff(attempt); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, w)
+		}
+	}
+}
+
+// txCounts counts transactions of a fake database
+type txCounts struct {
+	begins    int
+	commits   int
+	rollbacks int
+}
+
+// newFakeTxDB returns a database whose commits and statements fail with given errors in turn
+func newFakeTxDB(counts *txCounts, commitErrs []error, execErrs []error) *sql.DB {
+	return sql.OpenDB(&fakesql.DB{
+		Begin: func(opts driver.TxOptions) error {
+			counts.begins++
+			return nil
+		},
+		Commit: func() error {
+			var err error
+			if len(commitErrs) > 0 {
+				err, commitErrs = commitErrs[0], commitErrs[1:]
+			}
+			if err == nil {
+				counts.commits++
+			}
+			return err
+		},
+		Rollback: func() error {
+			counts.rollbacks++
+			return nil
+		},
+		Exec: func(string, []driver.Value) (driver.Result, error) {
+			var err error
+			if len(execErrs) > 0 {
+				err, execErrs = execErrs[0], execErrs[1:]
+			}
+			return driver.RowsAffected(1), err
+		},
+	})
+}
+
+func Test_WithTx(t *testing.T) {
+	serializationFailure := &pgconn.PgError{Code: sqlStateSerializationFailure}
+	deadlock := &pgconn.PgError{Code: sqlStateDeadlockDetected}
+
+	tests := []struct {
+		name        string
+		maxRetries  int
+		commitErrs  []error
+		execErrs    []error
+		wantErr     error
+		wantCounts  txCounts
+		wantRetries map[string]float64
+	}{
+		{
+			name:       "commit",
+			wantCounts: txCounts{begins: 1, commits: 1},
+		},
+		{
+			name:       "non-retryable error",
+			execErrs:   []error{errors.New("syntax error")},
+			wantErr:    errors.New("syntax error"),
+			wantCounts: txCounts{begins: 1, rollbacks: 1},
+		},
+		{
+			name:        "serialization failure on commit",
+			commitErrs:  []error{serializationFailure, serializationFailure},
+			wantCounts:  txCounts{begins: 3, commits: 1},
+			wantRetries: map[string]float64{sqlStateSerializationFailure: 2},
+		},
+		{
+			name:        "deadlock on statement",
+			execErrs:    []error{deadlock},
+			wantCounts:  txCounts{begins: 2, commits: 1, rollbacks: 1},
+			wantRetries: map[string]float64{sqlStateDeadlockDetected: 1},
+		},
+		{
+			name:        "retries exhausted",
+			maxRetries:  2,
+			execErrs:    []error{deadlock, serializationFailure, deadlock},
+			wantErr:     deadlock,
+			wantCounts:  txCounts{begins: 3, rollbacks: 3},
+			wantRetries: map[string]float64{sqlStateDeadlockDetected: 1, sqlStateSerializationFailure: 1},
+		},
+		{
+			name:       "retries disabled",
+			maxRetries: -1,
+			execErrs:   []error{deadlock},
+			wantErr:    deadlock,
+			wantCounts: txCounts{begins: 1, rollbacks: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTxMetrics()
+
+			ctx := WithQueryName(context.Background(), "tx_test")
+			txMetrics.RetriesCounter.DeletePartialMatch(map[string]string{"query": "tx_test"})
+
+			var counts txCounts
+			db := newFakeTxDB(&counts, tt.commitErrs, tt.execErrs)
+			defer func() { _ = db.Close() }()
+
+			opts := &TxOptions{Isolation: sql.LevelSerializable, MaxRetries: tt.maxRetries, Backoff: time.Microsecond}
+			err := WithTx(ctx, db, opts, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "UPDATE accounts SET balance = balance - 1")
+				return err
+			})
+
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.wantErr != nil && (err == nil || errors.Cause(err).Error() != tt.wantErr.Error()) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if counts != tt.wantCounts {
+				t.Errorf("counts = %+v, want %+v", counts, tt.wantCounts)
+			}
+
+			for _, code := range []string{sqlStateSerializationFailure, sqlStateDeadlockDetected} {
+				retries := testutil.ToFloat64(txMetrics.RetriesCounter.WithLabelValues("tx_test", code))
+				if retries != tt.wantRetries[code] {
+					t.Errorf("%s retries = %v, want %v", code, retries, tt.wantRetries[code])
+				}
+			}
+		})
+	}
+}
+
+func Test_WithTx_panic(t *testing.T) {
+	var counts txCounts
+	db := newFakeTxDB(&counts, nil, nil)
+	defer func() { _ = db.Close() }()
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("recovered %v, want the panic of fn", p)
+		}
+
+		if counts != (txCounts{begins: 1, rollbacks: 1}) {
+			t.Errorf("counts = %+v, the transaction is not rolled back", counts)
+		}
+	}()
+
+	_ = WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+		panic("boom")
+	})
+
+	t.Error("panic is not propagated")
+}
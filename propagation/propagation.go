@@ -0,0 +1,135 @@
+package infrapropagation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pushwoosh/infra/log"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Message headers used for context propagation
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+	HeaderRequestID   = "x-request-id"
+
+	// HeaderLogFieldPrefix is a prefix of headers carrying log fields selected by RegisterLogFields
+	HeaderLogFieldPrefix = "x-log-"
+)
+
+// Log fields set on the restored context
+const (
+	LogFieldRequestID = "request_id"
+	LogFieldTraceID   = "trace_id"
+)
+
+// Carrier is an adapter of message headers
+type Carrier = propagation.TextMapCarrier
+
+var traceContext = propagation.TraceContext{}
+
+var (
+	logFieldsMu sync.RWMutex
+	logFields   = make(map[string]struct{})
+)
+
+// RegisterLogFields selects infralog context fields that are propagated through message headers
+func RegisterLogFields(keys ...string) {
+	logFieldsMu.Lock()
+	defer logFieldsMu.Unlock()
+
+	for _, key := range keys {
+		logFields[key] = struct{}{}
+	}
+}
+
+func isLogFieldRegistered(key string) bool {
+	logFieldsMu.RLock()
+	defer logFieldsMu.RUnlock()
+
+	_, ok := logFields[key]
+	return ok
+}
+
+type requestIDCtxKeyType string
+
+const requestIDCtxKey requestIDCtxKeyType = "request_id"
+
+// WithRequestID returns a child context holding a given request id.
+// The request id is also added to the context's log fields.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDCtxKey, requestID)
+	return infralog.ChildWithFields(ctx, zap.String(LogFieldRequestID, requestID))
+}
+
+// RequestIDFromContext returns request id stored in the context or empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDCtxKey).(string)
+	return requestID
+}
+
+// Inject puts W3C trace context, request id and registered log fields of the context into a carrier
+func Inject(ctx context.Context, carrier Carrier) {
+	traceContext.Inject(ctx, carrier)
+
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		carrier.Set(HeaderRequestID, requestID)
+	}
+
+	for _, field := range infralog.FieldsFromContext(ctx) {
+		// request id and trace id are restored from their own headers
+		if field.Key == LogFieldRequestID || field.Key == LogFieldTraceID || !isLogFieldRegistered(field.Key) {
+			continue
+		}
+
+		carrier.Set(HeaderLogFieldPrefix+field.Key, fieldValue(field))
+	}
+}
+
+// Extract restores W3C trace context, request id and log fields from a carrier into a child context
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	ctx = traceContext.Extract(ctx, carrier)
+
+	var fields []zap.Field
+	if requestID := carrier.Get(HeaderRequestID); requestID != "" {
+		ctx = context.WithValue(ctx, requestIDCtxKey, requestID)
+		fields = append(fields, zap.String(LogFieldRequestID, requestID))
+	}
+
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		fields = append(fields, zap.String(LogFieldTraceID, spanCtx.TraceID().String()))
+	}
+
+	for _, key := range carrier.Keys() {
+		if !strings.HasPrefix(key, HeaderLogFieldPrefix) {
+			continue
+		}
+
+		fieldKey := strings.TrimPrefix(key, HeaderLogFieldPrefix)
+		if !isLogFieldRegistered(fieldKey) {
+			continue
+		}
+
+		fields = append(fields, zap.String(fieldKey, carrier.Get(key)))
+	}
+
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	return infralog.ChildWithFields(ctx, fields...)
+}
+
+// fieldValue converts zap field value to string
+func fieldValue(field zap.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+
+	return fmt.Sprint(enc.Fields[field.Key])
+}
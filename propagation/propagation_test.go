@@ -0,0 +1,67 @@
+package infrapropagation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pushwoosh/infra/log"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func Test_InjectExtract(t *testing.T) {
+	RegisterLogFields("user_id")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = infralog.WithFields(ctx, zap.Int("user_id", 42), zap.String("secret", "value"))
+
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+
+	if carrier.Get(HeaderTraceParent) != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("unexpected traceparent %q", carrier.Get(HeaderTraceParent))
+	}
+
+	if carrier.Get(HeaderLogFieldPrefix+"secret") != "" {
+		t.Error("expected unregistered log field not to be propagated")
+	}
+
+	restored := Extract(context.Background(), carrier)
+
+	if RequestIDFromContext(restored) != "req-1" {
+		t.Errorf("expected request id req-1, got %q", RequestIDFromContext(restored))
+	}
+
+	if trace.SpanContextFromContext(restored).TraceID() != traceID {
+		t.Error("expected trace id to be restored")
+	}
+
+	fields := make(map[string]string)
+	for _, field := range infralog.FieldsFromContext(restored) {
+		fields[field.Key] = field.String
+	}
+
+	expected := map[string]string{
+		LogFieldRequestID: "req-1",
+		LogFieldTraceID:   traceID.String(),
+		"user_id":         "42",
+	}
+
+	if len(fields) != len(expected) {
+		t.Errorf("expected %d log fields, got %v", len(expected), fields)
+	}
+
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("expected log field %s = %q, got %q", key, value, fields[key])
+		}
+	}
+}
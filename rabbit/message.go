@@ -41,3 +41,7 @@ func (m *Message) IsRedelivered() bool {
 func (m *Message) Body() []byte {
 	return m.msg.Body
 }
+
+func (m *Message) Headers() map[string]interface{} {
+	return m.msg.Headers
+}
@@ -36,6 +36,7 @@ type ProducerMessage struct {
 	Exchange   string
 	RoutingKey string
 	Priority   uint8
+	Headers    map[string]interface{} // optional
 }
 
 func (p *Producer) Produce(pCtx context.Context, msg *ProducerMessage) error {
@@ -65,6 +66,7 @@ func (p *Producer) Produce(pCtx context.Context, msg *ProducerMessage) error {
 				false,
 				false,
 				amqp.Publishing{
+					Headers:   msg.Headers,
 					Body:      msg.Body,
 					Priority:  msg.Priority,
 					Timestamp: time.Now(),
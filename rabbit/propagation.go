@@ -0,0 +1,51 @@
+package infrarabbit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pushwoosh/infra/propagation"
+)
+
+// tableCarrier adapts AMQP headers table to the propagation carrier
+type tableCarrier map[string]interface{}
+
+func (c tableCarrier) Get(key string) string {
+	switch value := c[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func (c tableCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c tableCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// InjectContext puts trace context, request id and registered log fields of the context into message headers
+func InjectContext(ctx context.Context, msg *ProducerMessage) {
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]interface{})
+	}
+
+	infrapropagation.Inject(ctx, tableCarrier(msg.Headers))
+}
+
+// ExtractContext restores trace context, request id and log fields from message headers
+func ExtractContext(ctx context.Context, msg *Message) context.Context {
+	return infrapropagation.Extract(ctx, tableCarrier(msg.Headers()))
+}